@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/internal/database"
+	"github.com/circleous/gitseer/internal/report"
+	"github.com/circleous/gitseer/pkg/signature"
 )
 
 func init() {
@@ -12,12 +18,15 @@ func init() {
 		"use json as output file type")
 	generateCmd.PersistentFlags().BoolVar(&htmlOut, "html", false,
 		"use html as output file type")
+	generateCmd.PersistentFlags().BoolVar(&sarifOut, "sarif", false,
+		"use sarif as output file type")
 	rootCmd.AddCommand(generateCmd)
 }
 
 var (
-	jsonOut bool
-	htmlOut bool
+	jsonOut  bool
+	htmlOut  bool
+	sarifOut bool
 )
 
 var generateCmd = &cobra.Command{
@@ -25,19 +34,82 @@ var generateCmd = &cobra.Command{
 	Short: "Generate findings data from database",
 	Long: `\
 Generate findings data from database. A file type can be choose either by
-specifying with the flag or output file name extension (.json or .html).`,
+specifying with the flag or output file name extension (.json, .html or
+.sarif).`,
 	Args: cobra.MinimumNArgs(1),
 	Run:  generate,
 }
 
 func generate(_ *cobra.Command, args []string) {
-	if jsonOut && htmlOut {
+	if countTrue(jsonOut, htmlOut, sarifOut) > 1 {
 		log.Error().
-			Msg("--json and --html flags can't be used together")
+			Msg("--json, --html and --sarif flags can't be used together")
 		os.Exit(1)
 	}
 
 	outputFileName := args[0]
 
-	log.Debug().Str("filename", outputFileName).Msg("output")
+	var format string
+	switch {
+	case jsonOut:
+		format = report.JSON
+	case htmlOut:
+		format = report.HTML
+	case sarifOut:
+		format = report.SARIF
+	}
+
+	conf, err := analysis.ParseConfig(confPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to parse config file")
+		os.Exit(1)
+	}
+
+	if err = writeReport(conf, outputFileName, format); err != nil {
+		log.Error().Err(err).Str("filename", outputFileName).
+			Msg("failed to generate report")
+		os.Exit(1)
+	}
+
+	log.Info().Str("filename", outputFileName).Msg("report generated")
+}
+
+// writeReport generates the report file from the configured database, if
+// format is empty, the file type is taken from the file name extension
+func writeReport(conf *analysis.Config, fileName, format string) error {
+	var err error
+
+	if format == "" {
+		if format, err = report.FormatFromFileName(fileName); err != nil {
+			return err
+		}
+	}
+
+	sig, err := signature.LoadSignature(conf.SignaturePath)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewDatabase(conf.DatabaseURI)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = db.Initialize(); err != nil {
+		return err
+	}
+
+	return report.Generate(context.Background(), db, sig.Signatures,
+		fileName, format)
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
 }
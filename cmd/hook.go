@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+const (
+	preCommitHook = "pre-commit"
+	prePushHook   = "pre-push"
+
+	// hookMarker marks the hook scripts written by install-hook, they're
+	// replaced without --force
+	hookMarker = "# installed by gitseer"
+)
+
+func init() {
+	installHookCmd.Flags().BoolVarP(&forceHook, "force", "f", false,
+		"replace the existing hook")
+	hookCmd.AddCommand(preCommitCmd, prePushCmd, installHookCmd)
+	rootCmd.AddCommand(hookCmd)
+}
+
+var (
+	forceHook bool
+)
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Scan for secrets as a git hook",
+	Long: `\
+Scan for secrets as a git hook in the current repository, the commit or push
+is stopped when any secret is found. Only signature_path and ignore_files are
+used from the config file. Use install-hook to install the hooks.`,
+}
+
+var preCommitCmd = &cobra.Command{
+	Use:   preCommitHook,
+	Short: "Scan the staged changes",
+	Long: `\
+Scan the lines added to the staged files since HEAD, the findings are printed
+and it exits with a non-zero status.`,
+	Args: cobra.NoArgs,
+	Run:  preCommit,
+}
+
+var prePushCmd = &cobra.Command{
+	Use:   prePushHook + " remote [url]",
+	Short: "Scan the pushed commits",
+	Long: `\
+Scan the commits of the pushed refs that the remote doesn't have yet, the refs
+are read from stdin as git passes them to the pre-push hook. The findings are
+printed and it exits with a non-zero status.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  prePush,
+}
+
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook [pre-commit|pre-push]...",
+	Short: "Install the git hooks to the current repository",
+	Long: `\
+Install the git hooks to the current repository, the hooks run this gitseer
+executable with the current config file. Both pre-commit and pre-push are
+installed if none is given.`,
+	ValidArgs: []string{preCommitHook, prePushHook},
+	Args:      cobra.OnlyValidArgs,
+	Run:       installHook,
+}
+
+// loadHookConfig return the config and the signatures for the hooks
+func loadHookConfig() (*analysis.Config, []signature.Base) {
+	conf, err := analysis.ParseLocalConfig(confPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to parse config file")
+		os.Exit(1)
+	}
+
+	sig, err := signature.LoadSignature(conf.SignaturePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to signature")
+		os.Exit(1)
+	}
+
+	return conf, sig.Signatures
+}
+
+// reportHookFindings prints the findings and exits with a non-zero status if
+// there's any
+func reportHookFindings(findings []analysis.HookFinding, hook string) {
+	if len(findings) == 0 {
+		return
+	}
+
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+
+	log.Error().Int("findings", len(findings)).Str("hook", hook).
+		Msg("possible secrets found, use --no-verify to skip the hook")
+	os.Exit(1)
+}
+
+func preCommit(_ *cobra.Command, _ []string) {
+	conf, sigs := loadHookConfig()
+
+	findings, err := analysis.ScanStaged(".", conf, sigs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to scan the staged files")
+		os.Exit(1)
+	}
+
+	reportHookFindings(findings, preCommitHook)
+}
+
+func prePush(_ *cobra.Command, args []string) {
+	conf, sigs := loadHookConfig()
+
+	updates, err := readPushUpdates(os.Stdin)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read the pushed refs")
+		os.Exit(1)
+	}
+
+	findings, err := analysis.ScanPush(".", args[0], updates, conf, sigs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to scan the pushed commits")
+		os.Exit(1)
+	}
+
+	reportHookFindings(findings, prePushHook)
+}
+
+// readPushUpdates reads the pre-push lines in
+// "<local ref> <local sha> <remote ref> <remote sha>" format
+func readPushUpdates(r io.Reader) ([]analysis.PushUpdate, error) {
+	var updates []analysis.PushUpdate
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid pre-push line %q",
+				scanner.Text())
+		}
+
+		updates = append(updates, analysis.PushUpdate{
+			LocalRef:   fields[0],
+			LocalHash:  fields[1],
+			RemoteRef:  fields[2],
+			RemoteHash: fields[3],
+		})
+	}
+
+	return updates, scanner.Err()
+}
+
+func installHook(_ *cobra.Command, args []string) {
+	hooks := args
+	if len(hooks) == 0 {
+		hooks = []string{preCommitHook, prePushHook}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get the gitseer executable")
+		os.Exit(1)
+	}
+
+	config, err := filepath.Abs(confPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get the config file path")
+		os.Exit(1)
+	}
+
+	for _, hook := range hooks {
+		hookPath, err := analysis.HookPath(".", hook)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get the hooks directory")
+			os.Exit(1)
+		}
+
+		if err = writeHook(hookPath, hook, exe, config); err != nil {
+			log.Error().Err(err).Str("path", hookPath).
+				Msg("failed to install hook")
+			os.Exit(1)
+		}
+
+		log.Info().Str("path", hookPath).Msg("hook installed")
+	}
+}
+
+// writeHook writes the hook script, an existing hook not installed by gitseer
+// is only replaced with --force
+func writeHook(hookPath, hook, exe, config string) error {
+	existing, err := os.ReadFile(hookPath)
+	if err == nil && !forceHook &&
+		!strings.Contains(string(existing), hookMarker) {
+		return errors.New("hook already exists, use --force to replace it")
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return err
+	}
+
+	// exec passes stdin through for the pre-push refs
+	script := fmt.Sprintf("#!/bin/sh\n%s\nexec %s -c %s hook %s \"$@\"\n",
+		hookMarker, shellQuote(exe), shellQuote(config), hook)
+
+	return os.WriteFile(hookPath, []byte(script), 0755)
+}
+
+// shellQuote quotes s as a single argument of sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
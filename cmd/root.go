@@ -12,10 +12,11 @@ var rootCmd = &cobra.Command{
 	Use:   "gitseer",
 	Short: "gitseer is a tool to scan for secrets in git repositories",
 	Long: `A flexible secrets scanner for git repositories. Currently supports
-gitlab and github.`,
+github, gitlab, gitea (or forgejo) and bitbucket (cloud and server).`,
 	CompletionOptions: cobra.CompletionOptions{
 		DisableDefaultCmd: true,
 	},
+	PersistentPreRun: checkConfig,
 }
 
 var (
@@ -50,14 +51,24 @@ func init() {
 		if verbose {
 			zerolog.SetGlobalLevel(zerolog.DebugLevel)
 		}
-
-		if _, err := os.Stat(confPath); os.IsNotExist(err) {
-			log.Error().Err(err).Msg("config file not exists!")
-			os.Exit(1)
-		}
 	})
 }
 
+// configOptional is the annotation of the commands that run without the
+// config file
+const configOptional = "config-optional"
+
+func checkConfig(cmd *cobra.Command, _ []string) {
+	if _, ok := cmd.Annotations[configOptional]; ok {
+		return
+	}
+
+	if _, err := os.Stat(confPath); os.IsNotExist(err) {
+		log.Error().Err(err).Msg("config file not exists!")
+		os.Exit(1)
+	}
+}
+
 // Execute root cobra executor
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -2,18 +2,18 @@ package cmd
 
 import (
 	"os"
-	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/internal/report"
 	"github.com/circleous/gitseer/pkg/signature"
 )
 
 func init() {
 	scanCmd.PersistentFlags().StringVarP(&generatedFileName, "output", "o", "",
-		"generate a .json or .html report file after scan")
+		"generate a .json, .html or .sarif report file after scan")
 	rootCmd.AddCommand(scanCmd)
 }
 
@@ -35,6 +35,15 @@ func scan(_ *cobra.Command, _ []string) {
 		os.Exit(1)
 	}
 
+	// fail early before the long running scan
+	if generatedFileName != "" {
+		if _, err = report.FormatFromFileName(generatedFileName); err != nil {
+			log.Error().Err(err).Str("filename", generatedFileName).
+				Msg("invalid file type")
+			os.Exit(1)
+		}
+	}
+
 	sig, err := signature.LoadSignature(conf.SignaturePath)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to signature")
@@ -51,12 +60,9 @@ func scan(_ *cobra.Command, _ []string) {
 	a.Runner()
 
 	if generatedFileName != "" {
-		if strings.HasSuffix(generatedFileName, ".json") {
-
-		} else if strings.HasSuffix(generatedFileName, ".html") {
-
-		} else {
-			log.Error().Msg("invalid file type")
+		if err = writeReport(conf, generatedFileName, ""); err != nil {
+			log.Error().Err(err).Str("filename", generatedFileName).
+				Msg("failed to generate report")
 			os.Exit(1)
 		}
 	}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/internal/database"
+	"github.com/circleous/gitseer/internal/report"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{scanLocalCmd, scanDirCmd} {
+		cmd.PersistentFlags().StringVarP(&generatedFileName, "output", "o",
+			"", "generate a .json, .html or .sarif report file after scan")
+		rootCmd.AddCommand(cmd)
+	}
+}
+
+var scanLocalCmd = &cobra.Command{
+	Use:   "scan-local path...",
+	Short: "Start scan for secrets in local repositories",
+	Long: `\
+Start scan for secrets in existing local repositories, the repositories are
+opened as they are without cloning or fetching. Organizations, users and
+repositories in the config file are not scanned. The database is optional when
+a report file is generated with --output.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		scanLocal(args, false)
+	},
+}
+
+var scanDirCmd = &cobra.Command{
+	Use:   "scan-dir path...",
+	Short: "Start scan for secrets in plain directories",
+	Long: `\
+Start scan for secrets in every file of plain directories without git, e.g. an
+extracted artifact or a build context. The findings are reported by the file
+path without a commit. The config file is used the same as scan-local.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		scanLocal(args, true)
+	},
+}
+
+// scanLocal scans the local repositories, or the plain directories if dirs is
+// true
+func scanLocal(paths []string, dirs bool) {
+	conf, err := analysis.ParseLocalConfig(confPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to parse config file")
+		os.Exit(1)
+	}
+
+	var format string
+	if generatedFileName != "" {
+		format, err = report.FormatFromFileName(generatedFileName)
+		if err != nil {
+			log.Error().Err(err).Str("filename", generatedFileName).
+				Msg("invalid file type")
+			os.Exit(1)
+		}
+	}
+
+	// the findings only need to live until the report is generated
+	if conf.DatabaseURI == "" {
+		if generatedFileName == "" {
+			log.Error().Msg("database is not defined, use --output to scan " +
+				"without database")
+			os.Exit(1)
+		}
+		conf.DatabaseURI = database.MemoryURI
+	}
+
+	conf.Organizations = nil
+	conf.Users = nil
+	conf.Repositories = nil
+	if dirs {
+		conf.LocalDirs = paths
+	} else {
+		conf.LocalPaths = paths
+	}
+
+	sig, err := signature.LoadSignature(conf.SignaturePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to signature")
+		os.Exit(1)
+	}
+
+	a, err := analysis.New(conf, sig.Signatures)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to initialize")
+		os.Exit(1)
+	}
+	defer a.Close()
+
+	a.Runner()
+
+	if generatedFileName != "" {
+		err = report.Generate(context.Background(), a.Database(),
+			sig.Signatures, generatedFileName, format)
+		if err != nil {
+			log.Error().Err(err).Str("filename", generatedFileName).
+				Msg("failed to generate report")
+			os.Exit(1)
+		}
+	}
+}
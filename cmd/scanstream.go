@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+func init() {
+	scanStreamCmd.Flags().StringVarP(&streamSignaturePath, "signatures",
+		"S", "", "signature file, default to signature_path of the config file")
+	scanStreamCmd.Flags().IntVar(&streamChunkSize, "chunk-size",
+		analysis.DefaultStreamChunkSize, "max size in bytes of a chunk")
+	rootCmd.AddCommand(scanStreamCmd)
+}
+
+var (
+	streamSignaturePath string
+	streamChunkSize     int
+)
+
+var scanStreamCmd = &cobra.Command{
+	Use:   "scan-stream [file]",
+	Short: "Scan stdin or a file for secrets",
+	Long: `\
+Scan stdin, or the file if it's given, for secrets with the content signatures,
+e.g. a CI build log. The stream is scanned in chunks as it's read and every
+finding is printed as a JSON line. The config file is only needed when
+--signatures isn't set, the database is never used.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{configOptional: ""},
+	Run:         scanStream,
+}
+
+// streamFinding is a JSON line of scan-stream, the keys are the same as the
+// json report. line_num is one based
+type streamFinding struct {
+	Source      string  `json:"source"`
+	SignatureID string  `json:"signature_id"`
+	Description string  `json:"description"`
+	LineNumber  int32   `json:"line_num"`
+	MatchString string  `json:"match_string"`
+	Entropy     float64 `json:"entropy,omitempty"`
+}
+
+// streamSignatures loads the --signatures file, or signature_path of the
+// config file
+func streamSignatures() (*signature.Signature, error) {
+	if streamSignaturePath != "" {
+		return signature.LoadSignature(streamSignaturePath)
+	}
+
+	if _, err := os.Stat(confPath); os.IsNotExist(err) {
+		return nil, errors.New("--signatures or the config file is required")
+	}
+
+	conf, err := analysis.ParseLocalConfig(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return signature.LoadSignature(conf.SignaturePath)
+}
+
+func scanStream(_ *cobra.Command, args []string) {
+	if streamChunkSize <= 0 {
+		log.Error().Int("chunk-size", streamChunkSize).
+			Msg("chunk size must be positive")
+		os.Exit(1)
+	}
+
+	sig, err := streamSignatures()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to signature")
+		os.Exit(1)
+	}
+
+	var r io.Reader = os.Stdin
+	source := "stdin"
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Error().Err(err).Msg("failed to open file")
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		r, source = f, args[0]
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	err = analysis.ScanStream(r, streamChunkSize, sig.Signatures,
+		func(match signature.Match) error {
+			return enc.Encode(streamFinding{
+				Source:      source,
+				SignatureID: match.SignatureID,
+				Description: match.Description,
+				LineNumber:  match.LineNumber,
+				MatchString: match.Substring,
+				Entropy:     match.Entropy,
+			})
+		})
+	if err != nil {
+		log.Error().Err(err).Str("source", source).Msg("failed to scan")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	cgit "github.com/circleous/gitseer/pkg/git"
+)
+
+// defaultCloneUsername is the username for clone_token and SSH URLs without
+// user info
+const defaultCloneUsername = "git"
+
+// AuthConfig is the credential for cloning repositories, it replaces the
+// service token. With SSHKey or SSHAgent the repositories are cloned with
+// their SSH URL
+type AuthConfig struct {
+	// CloneUsername is the HTTP basic auth username for CloneToken
+	CloneUsername string `toml:"clone_username"`
+
+	// CloneToken is the HTTP basic auth password, e.g. an access token
+	CloneToken string `toml:"clone_token"`
+
+	// SSHKey is the path to the SSH private key
+	SSHKey string `toml:"ssh_key"`
+
+	// SSHKeyPassphrase is the passphrase of SSHKey, if it's encrypted
+	SSHKeyPassphrase string `toml:"ssh_key_passphrase"`
+
+	// SSHAgent if set to true, the SSH agent from SSH_AUTH_SOCK is used
+	SSHAgent bool `toml:"ssh_agent"`
+}
+
+func (ac *AuthConfig) useSSH() bool {
+	return ac.SSHKey != "" || ac.SSHAgent
+}
+
+func (ac *AuthConfig) isEmpty() bool {
+	return !ac.useSSH() && ac.CloneToken == ""
+}
+
+// RepositoryConfig is an entry of repositories, either the URL string or a
+// table with url and the AuthConfig keys
+type RepositoryConfig struct {
+	// URL git clone-able URL
+	URL string `toml:"url"`
+
+	AuthConfig
+}
+
+// UnmarshalTOML decodes the URL string or the table entry
+func (rc *RepositoryConfig) UnmarshalTOML(data interface{}) error {
+	var ok bool
+
+	switch v := data.(type) {
+	case string:
+		rc.URL = v
+		return nil
+	case map[string]interface{}:
+		for key, value := range v {
+			switch key {
+			case "url":
+				rc.URL, ok = value.(string)
+			case "clone_username":
+				rc.CloneUsername, ok = value.(string)
+			case "clone_token":
+				rc.CloneToken, ok = value.(string)
+			case "ssh_key":
+				rc.SSHKey, ok = value.(string)
+			case "ssh_key_passphrase":
+				rc.SSHKeyPassphrase, ok = value.(string)
+			case "ssh_agent":
+				rc.SSHAgent, ok = value.(bool)
+			default:
+				return fmt.Errorf("repositories: unknown key %q", key)
+			}
+
+			if !ok {
+				return fmt.Errorf("repositories: invalid %s %v", key, value)
+			}
+		}
+
+		if rc.URL == "" {
+			return fmt.Errorf("repositories: url is required")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("repositories: invalid entry %v", data)
+}
+
+// newRepository creates the repository of a repositories entry, the name is
+// the URL path without .git suffix
+func newRepository(rc RepositoryConfig) (cgit.Repository, error) {
+	ep, err := transport.NewEndpoint(rc.URL)
+	if err != nil {
+		return cgit.Repository{}, err
+	}
+
+	repo := cgit.Repository{
+		Name: strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git"),
+		URL:  rc.URL,
+		Host: ep.Host,
+	}
+
+	if ep.Protocol == "ssh" {
+		repo.SSHURL = rc.URL
+	}
+
+	return repo, nil
+}
+
+// cloneAuth return the auth method and the URL for cloning the repository.
+// auth takes precedence over the repository credential, nil auth method is
+// anonymous clone
+func cloneAuth(repo cgit.Repository, auth *AuthConfig) (transport.AuthMethod,
+	string, error) {
+	if auth != nil && auth.useSSH() {
+		cloneURL := repo.SSHURL
+		if cloneURL == "" {
+			cloneURL = repo.URL
+		}
+
+		ep, err := transport.NewEndpoint(cloneURL)
+		if err != nil {
+			return nil, "", err
+		}
+
+		user := ep.User
+		if user == "" {
+			user = defaultCloneUsername
+		}
+
+		if auth.SSHAgent {
+			method, err := gitssh.NewSSHAgentAuth(user)
+			return method, cloneURL, err
+		}
+
+		method, err := gitssh.NewPublicKeysFromFile(user, auth.SSHKey,
+			auth.SSHKeyPassphrase)
+		return method, cloneURL, err
+	}
+
+	if auth != nil && auth.CloneToken != "" {
+		username := auth.CloneUsername
+		if username == "" {
+			username = defaultCloneUsername
+		}
+
+		return &githttp.BasicAuth{
+			Username: username,
+			Password: auth.CloneToken,
+		}, repo.URL, nil
+	}
+
+	if repo.Credential != nil {
+		username, password, err := repo.Credential.BasicAuth()
+		if err != nil {
+			return nil, "", err
+		}
+
+		return &githttp.BasicAuth{
+			Username: username,
+			Password: password,
+		}, repo.URL, nil
+	}
+
+	return nil, repo.URL, nil
+}
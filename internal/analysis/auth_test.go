@@ -0,0 +1,64 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/circleous/gitseer/internal/analysis"
+)
+
+func TestRepositoriesConfig(t *testing.T) {
+	var config analysis.Config
+
+	_, err := toml.Decode(`
+repositories = [
+  "https://github.com/v8/v8.git",
+  { url = "git@github.com:org/private.git", ssh_key = "/keys/id_ed25519" },
+  { url = "https://git.example.com/org/repo.git", clone_token = "secret" },
+]
+
+[[service]]
+name = "ghe"
+type = "github"
+ssh_agent = true
+`, &config)
+	if err != nil {
+		t.Fatalf("failed to decode config, %v", err)
+	}
+
+	if len(config.Repositories) != 3 {
+		t.Fatalf("expected 3 repositories, got %d", len(config.Repositories))
+	}
+
+	if config.Repositories[0].URL != "https://github.com/v8/v8.git" {
+		t.Errorf("unexpected url %s", config.Repositories[0].URL)
+	}
+
+	if rc := config.Repositories[1]; rc.URL != "git@github.com:org/private.git" ||
+		rc.SSHKey != "/keys/id_ed25519" {
+		t.Errorf("unexpected ssh repository %+v", rc)
+	}
+
+	if rc := config.Repositories[2]; rc.CloneToken != "secret" {
+		t.Errorf("unexpected token repository %+v", rc)
+	}
+
+	if len(config.Services) != 1 || !config.Services[0].SSHAgent {
+		t.Errorf("expected service with ssh agent, got %+v", config.Services)
+	}
+}
+
+func TestRepositoriesConfigInvalid(t *testing.T) {
+	for _, data := range []string{
+		`repositories = [{ ssh_agent = true }]`,
+		`repositories = [{ url = "https://github.com/v8/v8.git", token = "x" }]`,
+		`repositories = [{ url = "https://github.com/v8/v8.git", ssh_agent = "yes" }]`,
+		`repositories = [1]`,
+	} {
+		var config analysis.Config
+		if _, err := toml.Decode(data, &config); err == nil {
+			t.Errorf("expected error decoding %s", data)
+		}
+	}
+}
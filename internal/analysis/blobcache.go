@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/circleous/gitseer/internal/database"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+// blobResult is the content scan result of a blob, or of the added lines of a
+// file patch
+type blobResult struct {
+	Binary  bool              `json:"binary,omitempty"`
+	Matches []signature.Match `json:"matches,omitempty"`
+}
+
+// blobCache is the content scan results keyed by blob hash, or by the blob
+// hashes of a file patch, identical content in other commits, paths or
+// repositories is not scanned again. Path matches depend on the file name so
+// they're not cached. It's safe for concurrent use, a nil blobCache caches
+// nothing
+type blobCache struct {
+	m       sync.Mutex
+	results map[string]blobResult
+	// maxSize is the max number of results, new results are not cached once
+	// it's full
+	maxSize int
+	// added are the keys of the results added since it's loaded
+	added []string
+	hits  int
+}
+
+func newBlobCache(maxSize int) *blobCache {
+	return &blobCache{
+		results: make(map[string]blobResult),
+		maxSize: maxSize,
+	}
+}
+
+// get return the cached result of key
+func (bc *blobCache) get(key string) (blobResult, bool) {
+	if bc == nil {
+		return blobResult{}, false
+	}
+
+	bc.m.Lock()
+	defer bc.m.Unlock()
+
+	result, ok := bc.results[key]
+	if ok {
+		bc.hits++
+	}
+
+	return result, ok
+}
+
+// add caches the result of key
+func (bc *blobCache) add(key string, result blobResult) {
+	if bc == nil {
+		return
+	}
+
+	bc.m.Lock()
+	defer bc.m.Unlock()
+
+	if _, ok := bc.results[key]; ok || len(bc.results) >= bc.maxSize {
+		return
+	}
+
+	bc.results[key] = result
+	bc.added = append(bc.added, key)
+}
+
+// load adds the results saved in the database with the same content
+// signatures fingerprint
+func (bc *blobCache) load(ctx context.Context, db database.Service,
+	fingerprint string) error {
+	blobs, err := db.GetBlobs(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	bc.m.Lock()
+	defer bc.m.Unlock()
+
+	for key, value := range blobs {
+		if len(bc.results) >= bc.maxSize {
+			break
+		}
+
+		var result blobResult
+		if err = json.Unmarshal([]byte(value), &result); err != nil {
+			log.Warn().Err(err).Str("blob", key).
+				Msg("invalid cached blob result, ignored")
+			continue
+		}
+		bc.results[key] = result
+	}
+
+	return nil
+}
+
+// save saves the results added since it's loaded to the database, the results
+// of the other fingerprints are replaced
+func (bc *blobCache) save(ctx context.Context, db database.Service,
+	fingerprint string) error {
+	bc.m.Lock()
+	defer bc.m.Unlock()
+
+	blobs := make(map[string]string, len(bc.added))
+	for _, key := range bc.added {
+		value, err := json.Marshal(bc.results[key])
+		if err != nil {
+			return err
+		}
+		blobs[key] = string(value)
+	}
+
+	if err := db.AddBlobs(ctx, fingerprint, blobs); err != nil {
+		return err
+	}
+	bc.added = nil
+
+	return nil
+}
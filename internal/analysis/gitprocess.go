@@ -2,16 +2,20 @@ package analysis
 
 import (
 	"errors"
-	"net/url"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/go-git/go-git/v5/storage/memory"
@@ -21,71 +25,198 @@ import (
 	"github.com/circleous/gitseer/pkg/signature"
 )
 
-func processFile(file *object.File, commit *object.Commit, repo cgit.Repository, ignoreFiles []string,
-	signatures []signature.Base) ([]signature.Match, error) {
+const (
+	// commitMessageFile is the file name of the commit message findings, the
+	// colon prefix keeps it apart from the repository paths
+	commitMessageFile = ":commit-message"
+	// tagMessageFile is the file name prefix of the annotated tag message
+	// findings, followed by the tag name
+	tagMessageFile = ":tag-message:"
+)
 
-	// skip if binary
-	if ok, err := file.IsBinary(); err != nil && ok {
-		return nil, nil
+// isIgnored checks filename against the ignore_files patterns
+func isIgnored(filename string, ignoreFiles []string) bool {
+	for _, ignoreFile := range ignoreFiles {
+		if ok, _ := filepath.Match(ignoreFile, filename); ok {
+			return true
+		}
 	}
+	return false
+}
 
+// processFile find matches in the file name and contents, the content matches
+// of the same blob are taken from cache
+func processFile(file *object.File, ignoreFiles []string,
+	signatures []signature.Base, cache *blobCache) ([]signature.Match, error) {
 	filename := file.Name
 
-	// check for ignored files
-	imatch := false
-	for _, ignoreFile := range ignoreFiles {
-		if imatch, _ = filepath.Match(ignoreFile, filename); imatch {
-			break
+	// if there's a match in ignored pattern, skip
+	if isIgnored(filename, ignoreFiles) {
+		return nil, nil
+	}
+
+	result, ok := cache.get(file.Hash.String())
+	if !ok {
+		var err error
+		if result, err = scanBlob(file, signatures); err != nil {
+			return nil, err
 		}
+		cache.add(file.Hash.String(), result)
 	}
 
-	// if there's a match in ignored pattern, skip
-	if imatch {
-		return nil, nil
+	// path signatures don't need the content, e.g. a binary keystore
+	matches := signature.ExtractPathMatch(filename, signatures)
+
+	// skip the content if binary
+	if result.Binary {
+		return matches, nil
+	}
+
+	return append(matches, result.Matches...), nil
+}
+
+// scanBlob find matches in the file contents
+func scanBlob(file *object.File,
+	signatures []signature.Base) (blobResult, error) {
+	if ok, err := file.IsBinary(); err == nil && ok {
+		return blobResult{Binary: true}, nil
 	}
 
 	// get the file content
 	content, err := file.Contents()
 	if err != nil {
-		log.Error().Err(err).Str("url", repo.URL).
-			Str("commit", commit.Hash.String()).
-			Str("path", filename).
-			Msg("failed to get file content")
-		return nil, err
+		return blobResult{}, err
 	}
 
-	// find any matches with signatures for file name and contents
-	matches := signature.ExtractMatch(filename, content, signatures)
+	return blobResult{
+		Matches: signature.ExtractContentMatch(content, signatures),
+	}, nil
+}
+
+// processChange find matches only in the added lines of the change, line
+// numbers are mapped to the new file. Path signatures only match when the file
+// is added or renamed in the change. The content matches of the same blob
+// change are taken from cache, the patch is only computed when it's not cached
+func processChange(change *object.Change, ignoreFiles []string,
+	signatures []signature.Base, cache *blobCache) ([]signature.Match, error) {
+	var matches []signature.Match
 
-	return matches, nil
+	// file could be deleted in this change
+	if change.To.Name == "" {
+		return nil, nil
+	}
+
+	filename := change.To.Name
+
+	// if there's a match in ignored pattern, skip
+	if isIgnored(filename, ignoreFiles) {
+		return nil, nil
+	}
+
+	if change.From.Name != filename {
+		matches = append(matches,
+			signature.ExtractPathMatch(filename, signatures)...)
+	}
+
+	// the same change of a blob has the same added lines, the from hash is
+	// zero for an added file
+	key := change.From.TreeEntry.Hash.String() + ".." +
+		change.To.TreeEntry.Hash.String()
+
+	result, ok := cache.get(key)
+	if !ok {
+		patch, err := change.Patch()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, filePatch := range patch.FilePatches() {
+			if filePatch.IsBinary() {
+				result.Binary = true
+				continue
+			}
+			result = scanChunks(filePatch.Chunks(), signatures)
+		}
+		cache.add(key, result)
+	}
+
+	if result.Binary {
+		return matches, nil
+	}
+
+	return append(matches, result.Matches...), nil
 }
 
-func processRepository(repo cgit.Repository, storageType, storagePath string,
-	ignoreFiles []string, signatures []signature.Base, findingC chan finding) {
+// scanChunks find matches in the added chunks of a file patch
+func scanChunks(chunks []fdiff.Chunk,
+	signatures []signature.Base) blobResult {
+	var result blobResult
+
+	// zero based line number of the current chunk in the new file
+	var lineNumber int32
+	for _, chunk := range chunks {
+		content := chunk.Content()
+
+		switch chunk.Type() {
+		case fdiff.Add:
+			for _, match := range signature.ExtractContentMatch(content,
+				signatures) {
+				match.LineNumber += lineNumber
+				result.Matches = append(result.Matches, match)
+			}
+			lineNumber += countLines(content)
+		case fdiff.Equal:
+			lineNumber += countLines(content)
+		}
+	}
+
+	return result
+}
+
+// countLines return the number of lines in s, the last line doesn't need to be
+// terminated with a newline
+func countLines(s string) int32 {
+	n := int32(strings.Count(s, "\n"))
+	if len(s) > 0 && s[len(s)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// cloneRepository clones the repository to the configured storage with auth,
+// or fetch the latest changes if it's already cloned in the disk storage. Local
+// repositories are opened instead
+func cloneRepository(repo cgit.Repository, auth *AuthConfig,
+	config *Config) (*git.Repository, error) {
 	var storer storage.Storer
 	var wt billy.Filesystem
-	var clonedRepository *git.Repository
 	var repoPath string
 
-	if storageType == memoryStorage {
+	// local repositories are scanned as they are, without fetching
+	if repo.Path != "" {
+		return openLocalRepository(repo)
+	}
+
+	method, cloneURL, err := cloneAuth(repo, auth)
+	if err != nil {
+		log.Error().Err(err).Str("url", repo.URL).
+			Msg("failed to get repository credential")
+		return nil, err
+	}
+
+	if config.StorageType == memoryStorage {
 		wt = memfs.New()
 		storer = memory.NewStorage()
-	} else if storageType == diskStorage {
-		u, err := url.Parse(repo.URL)
-		if err != nil {
-			log.Error().Err(err).Str("url", repo.URL).
-				Msg("invalid repository url")
-			return
-		}
-
-		repoPath = path.Join(storagePath, u.Host, repo.Name)
+	} else if config.StorageType == diskStorage {
+		repoPath = path.Join(config.StoragePath, repo.Host, repo.Name)
 		wt = osfs.New(repoPath)
 		dot, _ := wt.Chroot(".git")
 		storer = filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
 	}
 
 	clonedRepository, err := git.Clone(storer, wt, &git.CloneOptions{
-		URL: repo.URL,
+		URL:  cloneURL,
+		Auth: method,
 	})
 	// if there is already a repository, only chance that the session also using
 	// disk storage so we can go ahead open and pull
@@ -96,7 +227,23 @@ func processRepository(repo cgit.Repository, storageType, storagePath string,
 		if err != nil {
 			log.Error().Err(err).Str("path", repoPath).
 				Msg("failed to open repository")
-			return
+			return nil, err
+		}
+
+		// pull only updates the current branch, fetch the other branches
+		if config.AllBranch {
+			err = clonedRepository.Fetch(&git.FetchOptions{
+				RemoteName: "origin",
+				RefSpecs:   []gitconfig.RefSpec{branchRefSpec},
+				Tags:       git.AllTags,
+				Force:      true,
+				Auth:       method,
+			})
+			if err != nil && err != git.NoErrAlreadyUpToDate {
+				log.Error().Err(err).Str("path", repoPath).
+					Msg("failed to fetch")
+				return nil, err
+			}
 		}
 
 		// open the worktree
@@ -104,139 +251,465 @@ func processRepository(repo cgit.Repository, storageType, storagePath string,
 		if err != nil {
 			log.Error().Err(err).Str("path", repoPath).
 				Msg("failed to get the .git directory")
-			return
+			return nil, err
 		}
 
 		// pull from remote "origin"
-		err = worktree.Pull(&git.PullOptions{RemoteName: "origin"})
+		err = worktree.Pull(&git.PullOptions{
+			RemoteName: "origin",
+			Auth:       method,
+		})
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			log.Error().Err(err).Str("path", repoPath).Msg("failed to pull")
-			return
+			return nil, err
 		}
+	} else if err == transport.ErrRepositoryNotFound &&
+		repo.Kind == cgit.KindWiki {
+		// the wiki repository is only created after the first page is added
+		log.Debug().Str("url", repo.URL).Msg("wiki has no pages")
+		return nil, err
 	} else if err != nil {
 		log.Error().Err(err).Str("url", repo.URL).
 			Msg("failed to clone repository")
-		return
+		return nil, err
 	}
 
-	// iterate through commit objects
-	commits, err := clonedRepository.CommitObjects()
+	if config.WithPullRequest {
+		err = clonedRepository.Fetch(&git.FetchOptions{
+			RemoteName: "origin",
+			RefSpecs:   pullRequestRefSpecs,
+			Tags:       git.NoTags,
+			Force:      true,
+			Auth:       method,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			log.Error().Err(err).Str("url", repo.URL).
+				Msg("failed to fetch pull request refs")
+			return nil, err
+		}
+	}
+
+	return clonedRepository, nil
+}
+
+// fetchUpstream fetches the upstream branches of a forked repository to
+// upstreamRefPrefix, the upstream is on the same service so it's fetched with
+// the fork auth
+func fetchUpstream(r *git.Repository, repo cgit.Repository,
+	auth *AuthConfig) error {
+	method, fetchURL, err := cloneAuth(*repo.Upstream, auth)
 	if err != nil {
-		log.Error().Err(err).Str("url", repo.URL).
-			Msg("failed to get commit from the repository")
+		return err
+	}
+
+	// the upstream URL could be changed since the last fetch to disk storage
+	err = r.DeleteRemote(upstreamRemote)
+	if err != nil && err != git.ErrRemoteNotFound {
+		return err
+	}
+
+	_, err = r.CreateRemote(&gitconfig.RemoteConfig{
+		Name:  upstreamRemote,
+		URLs:  []string{fetchURL},
+		Fetch: []gitconfig.RefSpec{upstreamRefSpec},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.Fetch(&git.FetchOptions{
+		RemoteName: upstreamRemote,
+		RefSpecs:   []gitconfig.RefSpec{upstreamRefSpec},
+		Tags:       git.NoTags,
+		Force:      true,
+		Auth:       method,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	return nil
+}
+
+// newCommitFinding return the finding of matches in fileName of commit, with
+// the commit author and committer
+func newCommitFinding(repo cgit.Repository, commit *object.Commit,
+	refs []string, fileName string, matches []signature.Match) finding {
+	return finding{
+		repository: repo,
+		commitHash: commit.Hash.String(),
+		refs:       refs,
+		fileName:   fileName,
+		matches:    matches,
+		author:     commit.Author,
+		committer:  commit.Committer,
+	}
+}
+
+// processCommitMessage scans the commit message with the content signatures,
+// the findings are stored with commitMessageFile as the file name
+func processCommitMessage(repo cgit.Repository, commit *object.Commit,
+	refs []string, signatures []signature.Base, findingC chan finding) {
+	matches := signature.ExtractContentMatch(commit.Message, signatures)
+	if len(matches) == 0 {
 		return
 	}
 
-	log.Print(repo)
+	findingC <- newCommitFinding(repo, commit, refs, commitMessageFile,
+		matches)
+}
 
-	for {
-		commit, err := commits.Next()
+// processTagMessages scans the annotated tag messages with the content
+// signatures, the findings are stored on the tagged commit with the tagger.
+// The tags on the scanned commits are skipped, they're scanned by the previous
+// analysis or reported by the upstream of a fork
+func processTagMessages(repo cgit.Repository, r *git.Repository,
+	signatures []signature.Base, scanned map[plumbing.Hash]bool,
+	findingC chan finding) error {
+	tags, err := r.Tags()
+	if err != nil {
+		return err
+	}
+
+	return tags.ForEach(func(ref *plumbing.Reference) error {
+		// lightweight tags don't have a message
+		tag, err := r.TagObject(ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		commitHash, err := peelToCommit(r, tag.Hash)
 		if err != nil {
-			break
+			// tags could point to a non commit object, keep the tag hash
+			commitHash = tag.Hash
 		}
 
-		// get parent commit, if there isn't any, this could be the first commit,
-		// so we don't have to compare anything
-		parentCommit, err := commit.Parent(1)
-		if err != nil && !errors.Is(err, object.ErrParentNotFound) {
-			log.Error().Err(err).Str("url", repo.URL).
-				Str("commit", commit.Hash.String()).
-				Msg("failed to get parent commit from the repository")
+		if scanned[commitHash] {
+			return nil
+		}
+
+		matches := signature.ExtractContentMatch(tag.Message, signatures)
+		if len(matches) == 0 {
+			return nil
+		}
+
+		findingC <- finding{
+			repository: repo,
+			commitHash: commitHash.String(),
+			refs:       []string{ref.Name().String()},
+			fileName:   tagMessageFile + tag.Name,
+			matches:    matches,
+			author:     tag.Tagger,
+			committer:  tag.Tagger,
+		}
+
+		return nil
+	})
+}
+
+// diffCommits return the changes from parent to commit, with rename detection
+// like commit.Patch
+func diffCommits(parent, commit *object.Commit) (object.Changes, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return parentTree.Diff(tree)
+}
+
+// mergeChanges return the changes of a merge commit from its first parent
+// where the file also differs from every other parent, e.g. a conflict
+// resolution. The other changes only bring the file of another parent
+func mergeChanges(commit *object.Commit,
+	changes object.Changes) (object.Changes, error) {
+	var parentTrees []*object.Tree
+	for i := 1; i < commit.NumParents(); i++ {
+		parent, err := commit.Parent(i)
+		if err != nil {
+			return nil, err
+		}
+
+		tree, err := parent.Tree()
+		if err != nil {
+			return nil, err
+		}
+		parentTrees = append(parentTrees, tree)
+	}
+
+	var merged object.Changes
+	for _, change := range changes {
+		// deleted files don't add anything
+		if change.To.Name == "" {
 			continue
 		}
 
-		tree, err := commit.Tree()
+		fromParent := false
+		for _, tree := range parentTrees {
+			entry, err := tree.FindEntry(change.To.Name)
+			if err == nil && entry.Hash == change.To.TreeEntry.Hash {
+				fromParent = true
+				break
+			}
+		}
+
+		if !fromParent {
+			merged = append(merged, change)
+		}
+	}
+
+	return merged, nil
+}
+
+// processCommit scans the message and the changes introduced by commit, refs
+// are the refs the commit is reachable from
+func processCommit(repo cgit.Repository, commit *object.Commit, refs []string,
+	ignoreFiles []string, signatures []signature.Base, cache *blobCache,
+	findingC chan finding) {
+	processCommitMessage(repo, commit, refs, signatures, findingC)
+
+	// get parent commit, if there isn't any, this could be the first commit,
+	// so every file in the tree is added
+	parentCommit, err := commit.Parent(0)
+	if err != nil && !errors.Is(err, object.ErrParentNotFound) {
+		log.Error().Err(err).Str("url", repo.URL).
+			Str("commit", commit.Hash.String()).
+			Msg("failed to get parent commit from the repository")
+		return
+	}
+
+	if parentCommit != nil {
+		changes, err := diffCommits(parentCommit, commit)
 		if err != nil {
 			log.Error().Err(err).Str("url", repo.URL).
 				Str("commit", commit.Hash.String()).
-				Msg("failed to get tree commit from the repository")
-			continue
+				Str("parent", parentCommit.Hash.String()).
+				Msg("failed to get changes")
+			return
 		}
 
-		// log.Print(repo.Name, commit.Hash.String())
+		// the files taken as they are from a parent are already scanned in
+		// the parent
+		if commit.NumParents() > 1 {
+			changes, err = mergeChanges(commit, changes)
+			if err != nil {
+				log.Error().Err(err).Str("url", repo.URL).
+					Str("commit", commit.Hash.String()).
+					Msg("failed to get merge parents")
+				return
+			}
+		}
 
-		if parentCommit != nil {
-			patch, err := parentCommit.Patch(commit)
+		for _, change := range changes {
+			matches, err := processChange(change, ignoreFiles, signatures,
+				cache)
 			if err != nil {
 				log.Error().Err(err).Str("url", repo.URL).
 					Str("commit", commit.Hash.String()).
-					Str("parent", parentCommit.Hash.String()).
+					Str("path", change.To.Name).
 					Msg("failed to get patch")
 				continue
 			}
-			filePatches := patch.FilePatches()
 
-			for _, file := range filePatches {
-				_, to := file.Files()
-				// file could be deleted in this patch
-				if to == nil {
-					continue
-				}
+			// skip if there isn't any match(s)
+			if len(matches) == 0 {
+				continue
+			}
 
-				file, err := tree.File(to.Path())
-				if err != nil {
-					log.Error().Err(err).Str("url", repo.URL).
-						Str("commit", commit.Hash.String()).
-						Str("path", to.Path()).
-						Msg("failed to get file")
-					continue
-				}
+			log.Debug().Str("repo", repo.Name).
+				Str("commit", commit.Hash.String()).
+				Str("path", change.To.Name).
+				Msgf("found %v", matches)
 
-				matches, err := processFile(file, commit, repo, ignoreFiles, signatures)
-				if err != nil {
-					log.Error().Err(err).Str("url", repo.URL).
-						Str("commit", commit.Hash.String()).
-						Str("path", file.Name).
-						Msg("failed to process file")
-					continue
-				}
+			findingC <- newCommitFinding(repo, commit, refs, change.To.Name,
+				matches)
+		}
 
-				// skip if there isn't any match(s)
-				if matches != nil || len(matches) == 0 {
-					continue
-				}
+		return
+	}
 
-				log.Debug().Str("repo", repo.Name).
-					Str("commit", commit.Hash.String()).
-					Str("path", file.Name).
-					Msgf("found %v", matches)
-
-				findingC <- finding{
-					repository: repo,
-					commitHash: commit.Hash.String(),
-					fileName:   file.Name,
-					matches:    matches,
-				}
-			}
-		} else {
-			files := tree.Files()
-			for {
-				file, err := files.Next()
-				if err != nil {
-					break
-				}
+	tree, err := commit.Tree()
+	if err != nil {
+		log.Error().Err(err).Str("url", repo.URL).
+			Str("commit", commit.Hash.String()).
+			Msg("failed to get tree commit from the repository")
+		return
+	}
 
-				matches, err := processFile(file, commit, repo, ignoreFiles, signatures)
-				if err != nil {
-					log.Error().Err(err).Str("url", repo.URL).
-						Str("commit", commit.Hash.String()).
-						Str("path", file.Name).
-						Msg("failed to process file")
-					continue
-				}
+	files := tree.Files()
+	for {
+		file, err := files.Next()
+		if err != nil {
+			break
+		}
 
-				// skip if there isn't any match(s)
-				if matches != nil || len(matches) == 0 {
-					continue
-				}
+		matches, err := processFile(file, ignoreFiles, signatures, cache)
+		if err != nil {
+			log.Error().Err(err).Str("url", repo.URL).
+				Str("commit", commit.Hash.String()).
+				Str("path", file.Name).
+				Msg("failed to process file")
+			continue
+		}
+
+		// skip if there isn't any match(s)
+		if len(matches) == 0 {
+			continue
+		}
+
+		findingC <- newCommitFinding(repo, commit, refs, file.Name, matches)
+	}
+}
+
+// processRepository scans the commits reachable from the repository refs but
+// not from the previously scanned commits, and return the repository with the
+// scanned commits updated. When HEAD is changed, the HEAD status of the known
+// file matches and the new file findings are returned. When the refs are
+// changed, the refs of the known commits are returned
+func processRepository(repo cgit.Repository, auth *AuthConfig,
+	config *Config, signatures []signature.Base, known knownFindings,
+	cache *blobCache, findingC chan finding) (scanResult, error) {
+	result := scanResult{repository: repo}
+
+	clonedRepository, err := cloneRepository(repo, auth, config)
+	if err != nil {
+		return result, err
+	}
+
+	head, tips, err := listRefs(clonedRepository, config.AllBranch,
+		config.WithPullRequest)
+	if err == plumbing.ErrReferenceNotFound {
+		// empty repository, nothing to scan
+		return result, nil
+	} else if err != nil {
+		log.Error().Err(err).Str("url", repo.URL).
+			Msg("failed to get refs from the repository")
+		return result, err
+	}
 
-				findingC <- finding{
-					repository: repo,
-					commitHash: commit.Hash.String(),
-					fileName:   file.Name,
-					matches:    matches,
+	// the history shared with the upstream is scanned and reported by the
+	// upstream, only the commits unique to the fork are scanned
+	upstream := make(map[plumbing.Hash]bool)
+	if repo.Upstream != nil {
+		err = fetchUpstream(clonedRepository, repo, auth)
+		if err == nil {
+			err = markRefs(clonedRepository, upstreamRefPrefix, upstream)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("url", repo.URL).
+				Str("upstream", repo.Upstream.URL).
+				Msg("failed to fetch upstream, scanning the full history")
+		}
+	}
+
+	// commits reachable from the last scanned commits are already scanned
+	scanned := make(map[plumbing.Hash]bool, len(upstream))
+	for hash := range upstream {
+		scanned[hash] = true
+	}
+	for _, hash := range repo.ScannedCommits() {
+		err = markAncestors(clonedRepository, plumbing.NewHash(hash), scanned)
+		if err != nil {
+			// history could be rewritten by force push
+			log.Warn().Err(err).Str("url", repo.URL).
+				Str("commit", hash).
+				Msg("last scanned commit is not found, rescanning its history")
+		}
+	}
+
+	log.Debug().Str("repo", repo.Name).Str("head", head.String()).
+		Int("refs", len(tips)).Str("since", repo.LatestCommit).
+		Msg("processing repository")
+
+	commits, reachable, err := newCommits(clonedRepository, tips, scanned)
+	if err != nil {
+		log.Error().Err(err).Str("url", repo.URL).
+			Msg("failed to get commit from the repository")
+		return result, err
+	}
+
+	// record the file matches of the new findings for the HEAD status
+	var findingMatches []findingMatch
+	repoFindingC := make(chan finding)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for f := range repoFindingC {
+			if isFileMatch(f) {
+				for _, match := range f.matches {
+					findingMatches = append(findingMatches, findingMatch{
+						fileMatch: fileMatch{
+							fileName:    f.fileName,
+							matchString: match.Substring,
+						},
+						commitHash: f.commitHash,
+						lineNumber: match.LineNumber,
+						commitTime: f.committer.When,
+					})
 				}
 			}
+			findingC <- f
 		}
+	}()
+
+	for _, commit := range commits {
+		processCommit(repo, commit, reachable[commit.Hash], config.IgnoreFiles,
+			signatures, cache, repoFindingC)
+	}
+
+	err = processTagMessages(repo, clonedRepository, signatures, scanned,
+		repoFindingC)
+	if err != nil {
+		log.Error().Err(err).Str("url", repo.URL).
+			Msg("failed to scan tag messages")
+	}
+
+	close(repoFindingC)
+	<-done
+
+	// the known file matches only change when HEAD is changed
+	if head.String() != repo.LatestCommit {
+		findingMatches = append(findingMatches, known.matches...)
 	}
+
+	if len(findingMatches) > 0 {
+		result.statuses, err = headStatuses(clonedRepository, head,
+			uniqueFindingMatches(findingMatches))
+		if err != nil {
+			// the findings are already saved, only the status is unknown
+			log.Error().Err(err).Str("url", repo.URL).
+				Msg("failed to check findings at HEAD")
+		}
+	}
+
+	// the known commits could be reachable from the new or moved refs, the
+	// refs are only saved with all_branch or with_pull_request
+	if len(repo.Refs) > 0 && len(known.commits) > 0 &&
+		refsChanged(tips, repo.Refs) {
+		result.commitRefs, err = commitRefs(clonedRepository, tips,
+			known.commits)
+		if err != nil {
+			// the findings keep the refs of the previous analysis
+			log.Error().Err(err).Str("url", repo.URL).
+				Msg("failed to get refs of the known commits")
+		}
+	}
+
+	repo.LatestCommit = head.String()
+	if config.AllBranch || config.WithPullRequest {
+		repo.Refs = make(map[string]string, len(tips))
+		for name, hash := range tips {
+			repo.Refs[name] = hash.String()
+		}
+	}
+	result.repository = repo
+
+	return result, nil
 }
@@ -0,0 +1,291 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	cgit "github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+// HookFinding is a match found by a git hook in the staged files or the pushed
+// commits, CommitHash is empty for the staged files
+type HookFinding struct {
+	CommitHash string
+	FileName   string
+	signature.Match
+}
+
+// String formats the finding as file:line: description: match, the line is
+// one based and it's omitted for a path match. The commit is prefixed for the
+// pushed commits
+func (hf HookFinding) String() string {
+	location := hf.FileName
+	if !(fileMatch{hf.FileName, hf.Substring}).isPathMatch() {
+		location = fmt.Sprintf("%s:%d", hf.FileName, hf.LineNumber+1)
+	}
+
+	if hf.CommitHash != "" {
+		location = hf.CommitHash + " " + location
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, hf.Description, hf.Substring)
+}
+
+// PushUpdate is a ref update read by the git pre-push hook, LocalHash is zero
+// when the remote ref is deleted and RemoteHash is zero when it's created
+type PushUpdate struct {
+	LocalRef   string
+	LocalHash  string
+	RemoteRef  string
+	RemoteHash string
+}
+
+// HookPath return the path of the git hook of the repository at repoPath
+func HookPath(repoPath, hook string) (string, error) {
+	r, err := openLocalRepository(cgit.Repository{Path: repoPath})
+	if err != nil {
+		return "", err
+	}
+
+	storer, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", errors.New("repository is not stored in the filesystem")
+	}
+
+	return filepath.Join(storer.Filesystem().Root(), "hooks", hook), nil
+}
+
+// ScanStaged scans the staged files of the repository at repoPath, only the
+// lines added since HEAD are scanned so the secrets already committed don't
+// block every commit
+// revive:disable-next-line:line-length-limit
+func ScanStaged(repoPath string, config *Config, signatures []signature.Base) ([]HookFinding, error) {
+	r, err := openLocalRepository(cgit.Repository{Path: repoPath})
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	// there isn't any HEAD tree before the first commit
+	var headTree *object.Tree
+	head, err := r.Head()
+	if err == nil {
+		commit, err := r.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+
+		if headTree, err = commit.Tree(); err != nil {
+			return nil, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	var findings []HookFinding
+	for _, entry := range idx.Entries {
+		matches, err := processStaged(r, headTree, entry, config.IgnoreFiles,
+			signatures)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			findings = append(findings, HookFinding{
+				FileName: entry.Name,
+				Match:    match,
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// processStaged find matches in the lines of the staged entry added since
+// headTree, path signatures only match when the file isn't in headTree
+func processStaged(r *git.Repository, headTree *object.Tree,
+	entry *index.Entry, ignoreFiles []string,
+	signatures []signature.Base) ([]signature.Match, error) {
+	var matches []signature.Match
+
+	// unmerged entries and submodules don't have the staged content, merged
+	// entries are stage 0, index.Merged is wrongly the same as AncestorMode
+	if entry.Stage != 0 || entry.Mode == filemode.Submodule {
+		return nil, nil
+	}
+
+	// if there's a match in ignored pattern, skip
+	if isIgnored(entry.Name, ignoreFiles) {
+		return nil, nil
+	}
+
+	var headFile *object.File
+	if headTree != nil {
+		var err error
+		headFile, err = headTree.File(entry.Name)
+		if err != nil && err != object.ErrFileNotFound {
+			return nil, err
+		}
+	}
+
+	// unchanged since HEAD
+	if headFile != nil && headFile.Hash == entry.Hash {
+		return nil, nil
+	}
+
+	if headFile == nil {
+		matches = signature.ExtractPathMatch(entry.Name, signatures)
+	}
+
+	blob, err := r.BlobObject(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	file := object.NewFile(entry.Name, entry.Mode, blob)
+	if ok, err := file.IsBinary(); err == nil && ok {
+		return matches, nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	var headContent string
+	if headFile != nil {
+		// a binary file could be changed to a text file
+		if ok, err := headFile.IsBinary(); err != nil || !ok {
+			if headContent, err = headFile.Contents(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := scanChunks(diffChunks(headContent, content), signatures)
+
+	return append(matches, result.Matches...), nil
+}
+
+// textChunk is a file patch chunk of a line diff
+type textChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c textChunk) Content() string {
+	return c.content
+}
+
+func (c textChunk) Type() fdiff.Operation {
+	return c.op
+}
+
+// diffChunks return the line diff from src to dst as file patch chunks
+func diffChunks(src, dst string) []fdiff.Chunk {
+	var chunks []fdiff.Chunk
+
+	for _, d := range diff.Do(src, dst) {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			chunks = append(chunks, textChunk{d.Text, fdiff.Add})
+		case diffmatchpatch.DiffDelete:
+			chunks = append(chunks, textChunk{d.Text, fdiff.Delete})
+		case diffmatchpatch.DiffEqual:
+			chunks = append(chunks, textChunk{d.Text, fdiff.Equal})
+		}
+	}
+
+	return chunks
+}
+
+// ScanPush scans the commits of the pushed refs that the remote doesn't have
+// yet, the commits reachable from the remote hash of the updates and from the
+// remote tracking branches of remote are skipped
+// revive:disable-next-line:line-length-limit
+func ScanPush(repoPath, remote string, updates []PushUpdate, config *Config, signatures []signature.Base) ([]HookFinding, error) {
+	repo := cgit.Repository{Name: repoPath, Path: repoPath}
+
+	r, err := openLocalRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make(map[string]plumbing.Hash)
+	scanned := make(map[plumbing.Hash]bool)
+	for _, update := range updates {
+		// the remote ref is deleted
+		local := plumbing.NewHash(update.LocalHash)
+		if local.IsZero() {
+			continue
+		}
+
+		hash, err := peelToCommit(r, local)
+		if err != nil {
+			// tags could point to a non commit object, nothing to scan
+			continue
+		}
+		tips[update.LocalRef] = hash
+
+		// the remote commit isn't fetched when the push is rejected as non
+		// fast-forward
+		remoteHash := plumbing.NewHash(update.RemoteHash)
+		if !remoteHash.IsZero() {
+			err = markAncestors(r, remoteHash, scanned)
+			if err != nil && err != plumbing.ErrObjectNotFound {
+				return nil, err
+			}
+		}
+	}
+
+	// remote could be a URL without any remote tracking branch
+	err = markRefs(r, "refs/remotes/"+remote+"/", scanned)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, reachable, err := newCommits(r, tips, scanned)
+	if err != nil {
+		return nil, err
+	}
+
+	findingC := make(chan finding)
+	done := make(chan []HookFinding)
+	go func() {
+		var findings []HookFinding
+		for f := range findingC {
+			for _, match := range f.matches {
+				findings = append(findings, HookFinding{
+					CommitHash: f.commitHash,
+					FileName:   f.fileName,
+					Match:      match,
+				})
+			}
+		}
+		done <- findings
+	}()
+
+	for _, commit := range commits {
+		processCommit(repo, commit, reachable[commit.Hash], config.IgnoreFiles,
+			signatures, nil, findingC)
+	}
+	close(findingC)
+
+	return <-done, nil
+}
@@ -0,0 +1,211 @@
+package analysis_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+var hookSignatures = []signature.Base{{
+	Type:        "content",
+	ID:          "password",
+	Description: "Password",
+	Enable:      true,
+	MatchString: `password = "\w+"`,
+	Match:       regexp.MustCompile(`password = "\w+"`),
+}}
+
+// keystoreSignature matches the binary keystore files by the extension
+var keystoreSignature = signature.Base{
+	Type:        "extension",
+	ID:          "keystore",
+	Description: "Java keystore file",
+	Enable:      true,
+	MatchString: ".jks",
+	Match:       ".jks",
+}
+
+// commitFile writes and stages the file, and commits it if message is set
+func commitFile(t *testing.T, r *git.Repository, dir, name, content,
+	message string) plumbing.Hash {
+	err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write %s, %v", name, err)
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree, %v", err)
+	}
+
+	if _, err = wt.Add(name); err != nil {
+		t.Fatalf("failed to stage %s, %v", name, err)
+	}
+
+	if message == "" {
+		return plumbing.ZeroHash
+	}
+
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "a", Email: "a@b", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit, %v", err)
+	}
+
+	return hash
+}
+
+func TestScanStaged(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	config := &analysis.Config{}
+
+	// nothing is committed yet
+	commitFile(t, r, dir, "a.txt", "password = \"first\"\n", "")
+	findings, err := analysis.ScanStaged(dir, config, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to scan staged files, %v", err)
+	}
+
+	if len(findings) != 1 || findings[0].String() !=
+		`a.txt:1: Password: password = "first"` {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+
+	// only the lines added since HEAD are scanned
+	commitFile(t, r, dir, "a.txt", "password = \"first\"\n", "first")
+	commitFile(t, r, dir, "a.txt",
+		"password = \"first\"\nok\npassword = \"second\"\n", "")
+	findings, err = analysis.ScanStaged(dir, config, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to scan staged files, %v", err)
+	}
+
+	if len(findings) != 1 || findings[0].String() !=
+		`a.txt:3: Password: password = "second"` {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func TestScanPush(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	pushed := commitFile(t, r, dir, "a.txt", "password = \"pushed\"\n",
+		"pushed")
+	local := commitFile(t, r, dir, "b.txt", "password = \"local\"\n", "local")
+
+	findings, err := analysis.ScanPush(dir, "origin", []analysis.PushUpdate{{
+		LocalRef:   "refs/heads/master",
+		LocalHash:  local.String(),
+		RemoteRef:  "refs/heads/master",
+		RemoteHash: pushed.String(),
+	}}, &analysis.Config{}, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to scan pushed commits, %v", err)
+	}
+
+	if len(findings) != 1 || findings[0].CommitHash != local.String() ||
+		findings[0].FileName != "b.txt" {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func TestScanPushMerge(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree, %v", err)
+	}
+
+	base := commitFile(t, r, dir, "a.txt", "base\n", "base")
+	branch := commitFile(t, r, dir, "b.txt", "password = \"branch\"\n",
+		"branch")
+
+	err = wt.Reset(&git.ResetOptions{Commit: base, Mode: git.HardReset})
+	if err != nil {
+		t.Fatalf("failed to reset, %v", err)
+	}
+	mainline := commitFile(t, r, dir, "c.txt", "ok\n", "main")
+
+	// b.txt is taken as it is from the branch, a.txt is changed in the merge
+	commitFile(t, r, dir, "b.txt", "password = \"branch\"\n", "")
+	commitFile(t, r, dir, "a.txt", "base\npassword = \"resolved\"\n", "")
+	merge, err := wt.Commit("merge", &git.CommitOptions{
+		Author:  &object.Signature{Name: "a", Email: "a@b", When: time.Now()},
+		Parents: []plumbing.Hash{mainline, branch},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit, %v", err)
+	}
+
+	findings, err := analysis.ScanPush(dir, "origin", []analysis.PushUpdate{{
+		LocalRef:   "refs/heads/master",
+		LocalHash:  merge.String(),
+		RemoteRef:  "refs/heads/master",
+		RemoteHash: plumbing.ZeroHash.String(),
+	}}, &analysis.Config{}, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to scan pushed commits, %v", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+
+	for _, f := range findings {
+		if f.CommitHash == merge.String() && f.FileName != "a.txt" ||
+			f.CommitHash == branch.String() && f.FileName != "b.txt" {
+			t.Errorf("unexpected finding %v", f)
+		}
+	}
+}
+
+func TestScanPushBinaryPath(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	// the root commit has every file in its tree
+	root := commitFile(t, r, dir, "release.jks", "\x00\xfe\xed\xfe\xed",
+		"root")
+
+	findings, err := analysis.ScanPush(dir, "origin", []analysis.PushUpdate{{
+		LocalRef:   "refs/heads/master",
+		LocalHash:  root.String(),
+		RemoteRef:  "refs/heads/master",
+		RemoteHash: plumbing.ZeroHash.String(),
+	}}, &analysis.Config{}, append(hookSignatures, keystoreSignature))
+	if err != nil {
+		t.Fatalf("failed to scan pushed commits, %v", err)
+	}
+
+	if len(findings) != 1 || findings[0].FileName != "release.jks" ||
+		findings[0].SignatureID != keystoreSignature.ID {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
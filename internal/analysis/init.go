@@ -6,10 +6,13 @@ import (
 	"os"
 
 	"github.com/BurntSushi/toml"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/circleous/gitseer/internal/database"
 	"github.com/circleous/gitseer/pkg/git"
 	"github.com/circleous/gitseer/pkg/gitservice"
+	"github.com/circleous/gitseer/pkg/gitservice/github"
 	"github.com/circleous/gitseer/pkg/signature"
 )
 
@@ -19,12 +22,56 @@ var (
 	defaultMaxWorker   = 10
 	defaultStorageType = memoryStorage
 	defaultWithFork    = false
+
+	// defaultBlobCacheSize is the default max number of cached blob results
+	defaultBlobCacheSize = 1 << 20
+	// defaultMaxFileSize is the default max size of a scanned directory file
+	defaultMaxFileSize int64 = 10 << 20
 )
 
+// ServiceConfig is an additional named git service, e.g. a GitHub Enterprise
+// Server instance. Organizations and users use the name as their type
+type ServiceConfig struct {
+	// Name is the service name, referenced by organization / user type
+	Name string `toml:"name"`
+
+	// Type is the git service type of the host
+	Type string `toml:"type"`
+
+	// BaseURL is the API URL for github, e.g.
+	// https://github.example.com/api/v3/, or the instance URL for the others
+	BaseURL string `toml:"base_url"`
+
+	// UploadURL is the github upload API URL, default to BaseURL
+	UploadURL string `toml:"upload_url"`
+
+	// Username is used with Token as password for bitbucket
+	Username string `toml:"username"`
+
+	// Token is the access token of the service
+	Token string `toml:"token"`
+
+	// Tokens are more github access tokens, rotated with Token by their
+	// remaining rate limit quota
+	Tokens []string `toml:"tokens"`
+
+	// AppID, InstallationID and PrivateKey are the GitHub App credential,
+	// used instead of Token for github when AppID is set. PrivateKey is the
+	// path to the PEM encoded private key
+	AppID          int64  `toml:"app_id"`
+	InstallationID int64  `toml:"installation_id"`
+	PrivateKey     string `toml:"private_key"`
+
+	// AuthConfig is the clone credential of the service repositories, the
+	// service token is used if it's not set
+	AuthConfig
+}
+
 // OrganizationConfig is per organization configuration struct. At least one of
 // ExpandUser or ExpandRepo needs to be set
 type OrganizationConfig struct {
-	// Type is the type of git service will be used to query
+	// Type is the type or the service name of git service will be used to
+	// query
 	Type string `toml:"type"`
 
 	// Name is the name of the organization
@@ -40,6 +87,10 @@ type OrganizationConfig struct {
 	// ExpandRepo if set to true, it will add organization repos to analysis
 	ExpandRepo bool `toml:"expand_repository"`
 
+	// ExpandGist if set to true, gists of the users added by ExpandUser or
+	// ExpandUserFuzzy are added to analysis, github only
+	ExpandGist bool `toml:"expand_gist"`
+
 	// WithFork if set to true, forked repository will be included into analysis
 	// override the global with_fork option
 	// WithFork bool `toml:"with_fork"`
@@ -47,12 +98,17 @@ type OrganizationConfig struct {
 
 // UserConfig is per user configuration struct.
 type UserConfig struct {
-	// Type is the type of git service will be used to query
+	// Type is the type or the service name of git service will be used to
+	// query
 	Type string `toml:"type"`
 
 	// Name is the name of the user
 	Name string `toml:"name"`
 
+	// ExpandGist if set to true, it will add user gists to analysis, github
+	// only
+	ExpandGist bool `toml:"expand_gist"`
+
 	// WithFork if set to true, forked repository will be included into analysis
 	// override the global with_fork option
 	// WithFork bool `toml:"with_fork"`
@@ -72,9 +128,44 @@ type Config struct {
 	StoragePath string `toml:"storage_path"`
 
 	// WithFork if set to true, forked repository will be included into the
-	// analysis process (default false)
+	// analysis process. The upstream of a github fork is added as well, and
+	// only the fork commits not in the upstream are scanned (default false)
 	WithFork bool `toml:"with_fork"`
 
+	// AllBranch if set to true, every branch and tag will be scanned, else only
+	// commits reachable from HEAD are scanned (default false)
+	AllBranch bool `toml:"all_branch"`
+
+	// WithPullRequest if set to true, pull request refs (refs/pull/*/head) and
+	// merge request refs (refs/merge-requests/*/head) will be fetched and
+	// scanned (default false)
+	WithPullRequest bool `toml:"with_pull_request"`
+
+	// WithWiki if set to true, the wiki of each repository with the wiki
+	// enabled will be scanned as a separate repository, github, gitlab and
+	// gitea only (default false)
+	WithWiki bool `toml:"with_wiki"`
+
+	// WithComments if set to true, issues, pull requests, their comments and
+	// commit comments are fetched from the API and scanned, github only
+	// (default false)
+	WithComments bool `toml:"with_comments"`
+
+	// BlobCacheSize is the max number of cached blob scan results, identical
+	// content in other commits and repositories is only scanned once, 0
+	// disables the cache (default 1048576)
+	BlobCacheSize int `toml:"blob_cache_size"`
+
+	// PersistBlobCache if set to true, the blob scan results are saved to the
+	// database and reused by the next analysis with the same signatures
+	// (default false)
+	PersistBlobCache bool `toml:"persist_blob_cache"`
+
+	// MaxFileSize is the max size in bytes of a file scanned by scan-dir, only
+	// the path of the larger files is scanned, 0 disables the limit (default
+	// 10485760)
+	MaxFileSize int64 `toml:"max_file_size"`
+
 	IgnoreFiles []string `toml:"ignore_files"`
 
 	DatabaseURI string `toml:"database"`
@@ -82,15 +173,70 @@ type Config struct {
 	// GithubToken
 	GithubToken string `toml:"github_token"`
 
+	// GithubTokens are more github tokens, rotated with GithubToken by their
+	// remaining rate limit quota
+	GithubTokens []string `toml:"github_tokens"`
+
+	// GithubAppID, GithubAppInstallationID and GithubAppPrivateKey are the
+	// GitHub App credential used instead of GithubToken when GithubAppID is
+	// set. GithubAppPrivateKey is the path to the PEM encoded private key
+	GithubAppID             int64  `toml:"github_app_id"`
+	GithubAppInstallationID int64  `toml:"github_app_installation_id"`
+	GithubAppPrivateKey     string `toml:"github_app_private_key"`
+
+	// GitlabToken
+	GitlabToken string `toml:"gitlab_token"`
+
+	// GitlabURL is the self-hosted gitlab instance URL, default to gitlab.com
+	GitlabURL string `toml:"gitlab_url"`
+
+	// GiteaToken
+	GiteaToken string `toml:"gitea_token"`
+
+	// GiteaURL is the gitea or forgejo instance URL, required for type gitea
+	GiteaURL string `toml:"gitea_url"`
+
+	// BitbucketUsername is used with BitbucketToken as app password
+	BitbucketUsername string `toml:"bitbucket_username"`
+
+	// BitbucketToken app password, or access token without username
+	BitbucketToken string `toml:"bitbucket_token"`
+
+	// BitbucketURL is the bitbucket cloud API URL, default to api.bitbucket.org
+	BitbucketURL string `toml:"bitbucket_url"`
+
+	// BitbucketServerUsername is used with BitbucketServerToken as password
+	BitbucketServerUsername string `toml:"bitbucket_server_username"`
+
+	// BitbucketServerToken password, or HTTP access token without username
+	BitbucketServerToken string `toml:"bitbucket_server_token"`
+
+	// BitbucketServerURL is the bitbucket server / data center instance URL,
+	// required for type bitbucket_server
+	BitbucketServerURL string `toml:"bitbucket_server_url"`
+
+	// Services are additional named git services
+	Services []ServiceConfig `toml:"service"`
+
 	// Organizations
 	Organizations []OrganizationConfig `toml:"organization"`
 
 	// Users
 	Users []UserConfig `toml:"user"`
 
-	// RepoURL are git clone-able URLs added directly to the analysis process
+	// Repositories are git clone-able URLs added directly to the analysis
+	// process, optionally with the clone credential
 	//   Example: https://github.com/v8/v8.git, file:///full/path/to/local/repo
-	RepoURL []string `toml:"repositories"`
+	//   { url = "git@github.com:org/repo.git", ssh_agent = true }
+	Repositories []RepositoryConfig `toml:"repositories"`
+
+	// LocalPaths are the paths of existing local repositories, they're opened
+	// instead of cloned. It's set by the scan-local command
+	LocalPaths []string `toml:"-"`
+
+	// LocalDirs are the paths of plain directories, every file is scanned
+	// without git. It's set by the scan-dir command
+	LocalDirs []string `toml:"-"`
 }
 
 type analysis struct {
@@ -101,23 +247,70 @@ type analysis struct {
 	repositories []git.Repository
 	signature    []signature.Base
 	finds        []finding
+
+	// serviceAuths are the clone credentials keyed by service name, and
+	// repoAuths are keyed by the repositories entry URL
+	serviceAuths map[string]*AuthConfig
+	repoAuths    map[string]*AuthConfig
+
+	// gistUsers are the users with expand_gist
+	gistUsers map[git.User]bool
+}
+
+// scanResult is the scanned repository with the HEAD status of its findings
+type scanResult struct {
+	repository git.Repository
+	statuses   []headStatus
+	// commitRefs are the updated refs of the known finding commits
+	commitRefs map[plumbing.Hash][]string
+}
+
+// knownFindings are the saved findings of a repository from the previous
+// analysis
+type knownFindings struct {
+	// matches are the file matches checked against HEAD
+	matches []findingMatch
+	// commits are the commits of the findings in the git history
+	commits []plumbing.Hash
 }
 
 type finding struct {
 	repository git.Repository
 	commitHash string
-	fileName   string
-	matches    []signature.Match
+	// refs are the refs the commit is reachable from
+	refs     []string
+	fileName string
+	matches  []signature.Match
+	// url links back to a finding outside of the git history
+	url string
+	// author and committer of the commit, both are the tagger for a tag
+	// message, the committer time is the commit time
+	author    object.Signature
+	committer object.Signature
 }
 
 // Service is the main interface for analysis module
 type Service interface {
 	Runner()
 	Close()
+
+	// Database return the database the findings are saved to
+	Database() database.Service
 }
 
 // ParseConfig builds a Config from a toml file
 func ParseConfig(configPath string) (*Config, error) {
+	return parseConfig(configPath, false)
+}
+
+// ParseLocalConfig builds a Config from a toml file for scanning local
+// repositories, database is optional and the storage options are not checked
+// since nothing is cloned
+func ParseLocalConfig(configPath string) (*Config, error) {
+	return parseConfig(configPath, true)
+}
+
+func parseConfig(configPath string, local bool) (*Config, error) {
 	var config Config
 
 	meta, err := toml.DecodeFile(configPath, &config)
@@ -125,7 +318,7 @@ func ParseConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
-	if !meta.IsDefined("database") {
+	if !local && !meta.IsDefined("database") {
 		return nil, errors.New("database is not defined")
 	}
 
@@ -137,32 +330,76 @@ func ParseConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if !local {
+		if err = checkStorage(&config, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if !meta.IsDefined("max_worker") {
+		config.MaxWorker = defaultMaxWorker
+	}
+
+	if !meta.IsDefined("storage_type") {
+		config.StorageType = defaultStorageType
+	}
+
+	if !meta.IsDefined("with_fork") {
+		config.WithFork = defaultWithFork
+	}
+
+	if !meta.IsDefined("blob_cache_size") {
+		config.BlobCacheSize = defaultBlobCacheSize
+	}
+
+	if !meta.IsDefined("max_file_size") {
+		config.MaxFileSize = defaultMaxFileSize
+	}
+
+	return &config, nil
+}
+
+// checkStorage checks the storage options used for cloning
+func checkStorage(config *Config, meta toml.MetaData) error {
 	if config.StorageType != memoryStorage &&
 		config.StorageType != diskStorage {
-		return nil, errors.New("invalid storage type")
+		return errors.New("invalid storage type")
 	}
 
 	if config.StorageType == diskStorage && !meta.IsDefined("storage_path") {
-		return nil, errors.New("storage_path is not defined")
+		return errors.New("storage_path is not defined")
 	}
 
 	if f, err := os.Stat(config.StoragePath); os.IsNotExist(err) || !f.IsDir() {
-		return nil, errors.New("storage_path doesn't exists or not a directory")
+		return errors.New("storage_path doesn't exists or not a directory")
 	}
 
-	if !meta.IsDefined("max_worker") {
-		config.MaxWorker = defaultMaxWorker
+	return nil
+}
+
+// githubAppOptions reads the GitHub App private key, it returns empty options
+// when appID is not set
+func githubAppOptions(appID, installationID int64,
+	privateKeyPath string) (github.AppOptions, error) {
+	if appID == 0 {
+		return github.AppOptions{}, nil
 	}
 
-	if !meta.IsDefined("storage_type") {
-		config.StorageType = defaultStorageType
+	if installationID == 0 || privateKeyPath == "" {
+		return github.AppOptions{}, errors.New(
+			"github app installation id and private key are required")
 	}
 
-	if !meta.IsDefined("with_fork") {
-		config.WithFork = defaultWithFork
+	privateKey, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return github.AppOptions{}, err
 	}
 
-	return &config, nil
+	return github.AppOptions{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+	}, nil
 }
 
 // New init analysis
@@ -185,22 +422,109 @@ func New(config *Config, sig []signature.Base) (Service, error) {
 	parent := context.Background()
 	ctx := context.WithValue(parent, git.MaxWorkerKey, config.MaxWorker)
 
-	gs := gitservice.NewGitService(ctx, &gitservice.Options{
-		GithubToken: config.GithubToken,
+	githubApp, err := githubAppOptions(config.GithubAppID,
+		config.GithubAppInstallationID, config.GithubAppPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []gitservice.ServiceOptions
+	for _, svc := range config.Services {
+		app, err := githubAppOptions(svc.AppID, svc.InstallationID,
+			svc.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		services = append(services, gitservice.ServiceOptions{
+			Name:      svc.Name,
+			Type:      svc.Type,
+			BaseURL:   svc.BaseURL,
+			UploadURL: svc.UploadURL,
+			Username:  svc.Username,
+			Token:     svc.Token,
+			Tokens:    svc.Tokens,
+			GithubApp: app,
+		})
+	}
+
+	gs, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		GithubToken:             config.GithubToken,
+		GithubTokens:            config.GithubTokens,
+		GithubApp:               githubApp,
+		GitlabToken:             config.GitlabToken,
+		GitlabBaseURL:           config.GitlabURL,
+		GiteaToken:              config.GiteaToken,
+		GiteaBaseURL:            config.GiteaURL,
+		BitbucketUsername:       config.BitbucketUsername,
+		BitbucketToken:          config.BitbucketToken,
+		BitbucketBaseURL:        config.BitbucketURL,
+		BitbucketServerUsername: config.BitbucketServerUsername,
+		BitbucketServerToken:    config.BitbucketServerToken,
+		BitbucketServerBaseURL:  config.BitbucketServerURL,
+		Services:                services,
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	gistUsers := make(map[git.User]bool)
 	for _, user := range config.Users {
-		users = append(users, git.User{
+		u := git.User{
 			Name: user.Name,
 			Type: user.Type,
-		})
+		}
+		users = append(users, u)
+
+		if user.ExpandGist {
+			gistUsers[u] = true
+		}
+	}
+
+	serviceAuths := make(map[string]*AuthConfig)
+	for i, svc := range config.Services {
+		if !svc.AuthConfig.isEmpty() {
+			serviceAuths[svc.Name] = &config.Services[i].AuthConfig
+		}
+	}
+
+	repoAuths := make(map[string]*AuthConfig)
+	for i, rc := range config.Repositories {
+		repo, err := newRepository(rc)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+
+		if !rc.AuthConfig.isEmpty() {
+			repoAuths[rc.URL] = &config.Repositories[i].AuthConfig
+		}
+	}
+
+	for _, localPath := range config.LocalPaths {
+		repo, err := newLocalRepository(localPath)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+
+	for _, localDir := range config.LocalDirs {
+		repo, err := newLocalDirectory(localDir)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
 	}
 
 	return &analysis{
 		db:           db,
 		config:       config,
+		serviceAuths: serviceAuths,
+		repoAuths:    repoAuths,
 		gs:           gs,
 		users:        users,
+		gistUsers:    gistUsers,
 		repositories: repos,
 		signature:    sig,
 		finds:        finds,
@@ -210,3 +534,7 @@ func New(config *Config, sig []signature.Base) (Service, error) {
 func (a *analysis) Close() {
 	a.db.Close()
 }
+
+func (a *analysis) Database() database.Service {
+	return a.db
+}
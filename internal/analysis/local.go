@@ -0,0 +1,215 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/rs/zerolog/log"
+
+	cgit "github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+// sniffLen is the number of bytes read to detect a binary file, the same as
+// object.File.IsBinary
+const sniffLen = 8000
+
+// errFileTooLarge is returned by readFile for the files over max_file_size
+var errFileTooLarge = errors.New("file is larger than max_file_size")
+
+// newLocalRepository return the repository of an existing local repository,
+// the absolute path is the repository name
+func newLocalRepository(localPath string) (cgit.Repository, error) {
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return cgit.Repository{}, err
+	}
+
+	return cgit.Repository{
+		Name: filepath.ToSlash(absPath),
+		URL:  "file://" + filepath.ToSlash(absPath),
+		Path: absPath,
+	}, nil
+}
+
+// openLocalRepository opens the local repository as it is, the path could be
+// a subdirectory of the worktree or a bare repository
+func openLocalRepository(repo cgit.Repository) (*git.Repository, error) {
+	r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("path", repo.Path).
+			Msg("failed to open repository")
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newLocalDirectory return the KindDirectory repository of a plain directory,
+// the absolute path is the repository name
+func newLocalDirectory(localDir string) (cgit.Repository, error) {
+	repo, err := newLocalRepository(localDir)
+	repo.Kind = cgit.KindDirectory
+
+	return repo, err
+}
+
+// processDirectory scans every regular file in the directory of repo with the
+// same signatures as the files in a commit, the findings are reported by the
+// relative path without a commit hash. .git directories are skipped, only the
+// path of binary files and the files over max_file_size is scanned
+func processDirectory(repo cgit.Repository, config *Config,
+	signatures []signature.Base, cache *blobCache,
+	findingC chan finding) error {
+	fs := osfs.New(repo.Path)
+
+	log.Debug().Str("path", repo.Path).Msg("processing directory")
+
+	err := walkFiles(fs, "", func(filename string, size int64) {
+		// skip reading the ignored files
+		if isIgnored(filename, config.IgnoreFiles) {
+			return
+		}
+
+		// the size is checked again while the file is read, it could grow
+		// after the walk
+		var file *object.File
+		err := errFileTooLarge
+		if config.MaxFileSize <= 0 || size <= config.MaxFileSize {
+			file, err = readFile(fs, filename, config.MaxFileSize)
+		}
+		// path signatures don't need the content, e.g. a binary keystore
+		var matches []signature.Match
+		switch {
+		case errors.Is(err, errFileTooLarge):
+			log.Warn().Str("path", repo.Path).Str("file", filename).
+				Int64("size", size).
+				Msg("skipping the content of file over max_file_size")
+			matches = signature.ExtractPathMatch(filename, signatures)
+		case err != nil:
+			log.Error().Err(err).Str("path", repo.Path).
+				Str("file", filename).
+				Msg("failed to read file")
+			return
+		case file == nil:
+			// binary files are not read past the first bytes
+			matches = signature.ExtractPathMatch(filename, signatures)
+		default:
+			matches, err = processFile(file, config.IgnoreFiles, signatures,
+				cache)
+			if err != nil {
+				log.Error().Err(err).Str("path", repo.Path).
+					Str("file", filename).
+					Msg("failed to process file")
+				return
+			}
+		}
+
+		// skip if there isn't any match(s)
+		if len(matches) == 0 {
+			return
+		}
+
+		findingC <- finding{
+			repository: repo,
+			fileName:   filename,
+			matches:    matches,
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Str("path", repo.Path).
+			Msg("failed to walk directory")
+	}
+
+	return err
+}
+
+// walkFiles calls fn with the slash separated path and the size of every
+// regular file in dir recursively, symlinks are not followed
+// revive:disable-next-line:line-length-limit
+func walkFiles(fs billy.Filesystem, dir string, fn func(filename string, size int64)) error {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		filename := path.Join(dir, info.Name())
+
+		switch {
+		case info.IsDir():
+			if info.Name() == git.GitDirName {
+				continue
+			}
+
+			if err = walkFiles(fs, filename, fn); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			fn(filename, info.Size())
+		}
+	}
+
+	return nil
+}
+
+// readFile reads the file as a blob, so it's scanned and cached like the files
+// in a commit. A binary file is detected from the first bytes and nil is
+// returned without reading the rest. errFileTooLarge is returned if the file
+// grows over maxSize while it's read, 0 is unlimited
+// revive:disable-next-line:line-length-limit
+func readFile(fs billy.Filesystem, filename string, maxSize int64) (*object.File, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, sniffLen)
+	// a shorter file is peeked whole with io.EOF
+	prefix, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if ok, err := binary.IsBinary(bytes.NewReader(prefix)); err != nil {
+		return nil, err
+	} else if ok {
+		return nil, nil
+	}
+
+	var r io.Reader = br
+	if maxSize > 0 {
+		r = io.LimitReader(br, maxSize+1)
+	}
+
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	if _, err = io.Copy(obj, r); err != nil {
+		return nil, err
+	}
+
+	if maxSize > 0 && obj.Size() > maxSize {
+		return nil, errFileTooLarge
+	}
+
+	blob, err := object.DecodeBlob(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.NewFile(filename, filemode.Regular, blob), nil
+}
@@ -0,0 +1,238 @@
+package analysis_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/internal/database"
+)
+
+func TestScanDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"config/app.env":  "debug = true\npassword = \"visible\"\n",
+		"config/copy.env": "debug = true\npassword = \"visible\"\n",
+		"vendor/lib.txt":  "password = \"ignored\"\n",
+		".git/config":     "password = \"gitdir\"\n",
+		"image.bin":       "\x00password = \"binary\"",
+		"build/app.log": "password = \"large\"\n" +
+			strings.Repeat("building step\n", 100),
+		// only the path of the binary and the large keystores is scanned
+		"keys/release.jks": "\x00\xfe\xed\xfe\xed",
+		"keys/large.jks": "password = \"large\"\n" +
+			strings.Repeat("keystore\n", 200),
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatalf("failed to create directory, %v", err)
+		}
+
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s, %v", name, err)
+		}
+	}
+
+	a, err := analysis.New(&analysis.Config{
+		MaxWorker:     2,
+		DatabaseURI:   database.MemoryURI,
+		BlobCacheSize: 10,
+		MaxFileSize:   1024,
+		IgnoreFiles:   []string{"vendor/*"},
+		LocalDirs:     []string{dir},
+	}, append(hookSignatures, keystoreSignature))
+	if err != nil {
+		t.Fatalf("failed to initialize analysis, %v", err)
+	}
+	defer a.Close()
+
+	a.Runner()
+
+	findings, err := a.Database().GetFindings(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get findings, %v", err)
+	}
+
+	var names []string
+	for _, f := range findings {
+		if f.CommitHash != "" || f.SignatureID == "password" &&
+			f.LineNumber != 1 {
+			t.Errorf("unexpected finding %+v", f)
+		}
+		names = append(names, f.Filename)
+	}
+
+	// identical content is still reported for every path
+	if strings.Join(names, " ") != "keys/large.jks keys/release.jks "+
+		"config/app.env config/copy.env" {
+		t.Errorf("unexpected findings in %v", names)
+	}
+}
+
+func TestScanLocalRefs(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	shared := commitFile(t, r, dir, "a.txt", "password = \"shared\"\n",
+		"shared")
+	err = r.Storer.SetReference(plumbing.NewHashReference(
+		"refs/heads/feature", shared))
+	if err != nil {
+		t.Fatalf("failed to create branch, %v", err)
+	}
+	commitFile(t, r, dir, "b.txt", "password = \"master\"\n", "master")
+
+	a, err := analysis.New(&analysis.Config{
+		MaxWorker:   2,
+		DatabaseURI: database.MemoryURI,
+		AllBranch:   true,
+		LocalPaths:  []string{dir},
+	}, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to initialize analysis, %v", err)
+	}
+	defer a.Close()
+
+	a.Runner()
+
+	findings, err := a.Database().GetFindings(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get findings, %v", err)
+	}
+
+	refs := make(map[string]string)
+	for _, f := range findings {
+		refs[f.Filename] = strings.Join(f.Refs, " ")
+	}
+
+	// the shared commit is reachable from both branches
+	if len(findings) != 2 ||
+		refs["a.txt"] != "refs/heads/feature refs/heads/master" ||
+		refs["b.txt"] != "refs/heads/master" {
+		t.Errorf("unexpected refs %v", refs)
+	}
+}
+
+func TestScanLocalHeadStatus(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	base := commitFile(t, r, dir, "a.txt", "password = \"removed\"\n", "add")
+	removing := commitFile(t, r, dir, "a.txt", "ok\n", "remove")
+
+	// the branch is never merged to HEAD
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree, %v", err)
+	}
+	err = wt.Checkout(&git.CheckoutOptions{
+		Hash: base, Branch: "refs/heads/feature", Create: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create branch, %v", err)
+	}
+	commitFile(t, r, dir, "b.txt", "password = \"branch\"\n", "branch")
+	err = wt.Checkout(&git.CheckoutOptions{Branch: "refs/heads/master"})
+	if err != nil {
+		t.Fatalf("failed to checkout master, %v", err)
+	}
+
+	a, err := analysis.New(&analysis.Config{
+		MaxWorker:   2,
+		DatabaseURI: database.MemoryURI,
+		AllBranch:   true,
+		LocalPaths:  []string{dir},
+	}, hookSignatures)
+	if err != nil {
+		t.Fatalf("failed to initialize analysis, %v", err)
+	}
+	defer a.Close()
+
+	a.Runner()
+
+	findings, err := a.Database().GetFindings(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get findings, %v", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+
+	for _, f := range findings {
+		if f.PresentAtHead == nil || *f.PresentAtHead {
+			t.Errorf("unexpected HEAD status of %s", f.Filename)
+		}
+
+		removedIn := ""
+		if f.Filename == "a.txt" {
+			removedIn = removing.String()
+		}
+		if f.RemovedIn != removedIn {
+			t.Errorf("unexpected removing commit of %s, %s", f.Filename,
+				f.RemovedIn)
+		}
+	}
+}
+
+func TestScanLocalNewRef(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repository, %v", err)
+	}
+
+	secret := commitFile(t, r, dir, "a.txt", "password = \"secret\"\n",
+		"secret")
+	commitFile(t, r, dir, "b.txt", "ok\n", "ok")
+
+	config := &analysis.Config{
+		MaxWorker:   2,
+		DatabaseURI: filepath.Join(t.TempDir(), "gitseer.db"),
+		AllBranch:   true,
+		LocalPaths:  []string{dir},
+	}
+	scan := func() []database.Finding {
+		a, err := analysis.New(config, hookSignatures)
+		if err != nil {
+			t.Fatalf("failed to initialize analysis, %v", err)
+		}
+		defer a.Close()
+
+		a.Runner()
+
+		findings, err := a.Database().GetFindings(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get findings, %v", err)
+		}
+		return findings
+	}
+	scan()
+
+	// the new branch points to the already scanned history
+	err = r.Storer.SetReference(plumbing.NewHashReference(
+		"refs/heads/feature", secret))
+	if err != nil {
+		t.Fatalf("failed to create branch, %v", err)
+	}
+
+	findings := scan()
+	if len(findings) != 1 || strings.Join(findings[0].Refs, " ") !=
+		"refs/heads/feature refs/heads/master" {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+}
@@ -3,10 +3,14 @@ package analysis
 import (
 	"context"
 
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/semaphore"
 
+	"github.com/circleous/gitseer/internal/database"
 	cgit "github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice"
+	"github.com/circleous/gitseer/pkg/signature"
 )
 
 func (a *analysis) processOrganizations(ctx context.Context) {
@@ -25,6 +29,11 @@ func (a *analysis) processOrganizations(ctx context.Context) {
 			continue
 		}
 
+		if org.ExpandGist && !org.ExpandUser && !org.ExpandUserFuzzy {
+			log.Info().Str("organization", org.Name).Str("type", org.Type).
+				Msg("expand_gist needs expand_user or expand_user_fuzzy")
+		}
+
 		if org.ExpandUser {
 			u, err := a.gs.ListOrgUsers(ctx, org.Type, org.Name)
 			if err != nil {
@@ -32,7 +41,7 @@ func (a *analysis) processOrganizations(ctx context.Context) {
 					Str("type", org.Type).
 					Msg("failed to fetch organization users")
 			} else if len(u) > 0 {
-				a.users = append(a.users, u...)
+				a.addUsers(u, org.ExpandGist)
 			}
 		}
 
@@ -43,7 +52,7 @@ func (a *analysis) processOrganizations(ctx context.Context) {
 					Str("type", org.Type).
 					Msg("failed to fetch fuzzy organization users")
 			} else if len(u) > 0 {
-				a.users = append(a.users, u...)
+				a.addUsers(u, org.ExpandGist)
 			}
 		}
 
@@ -61,6 +70,20 @@ func (a *analysis) processOrganizations(ctx context.Context) {
 	}
 }
 
+// addUsers adds expanded users to analysis, their gists are also added when
+// expandGist is true
+func (a *analysis) addUsers(users []cgit.User, expandGist bool) {
+	a.users = append(a.users, users...)
+
+	if !expandGist {
+		return
+	}
+
+	for _, user := range users {
+		a.gistUsers[user] = true
+	}
+}
+
 func (a *analysis) processUsers(ctx context.Context) {
 	listRepoOpt := &cgit.ListRepositoriesOptions{
 		WithFork: a.config.WithFork,
@@ -79,6 +102,22 @@ func (a *analysis) processUsers(ctx context.Context) {
 		} else if len(r) > 0 {
 			a.repositories = append(a.repositories, r...)
 		}
+
+		if !a.gistUsers[user] {
+			continue
+		}
+
+		// a user could be expanded from more than one organization
+		delete(a.gistUsers, user)
+
+		g, err := a.gs.ListUserGists(ctx, user.Type, user.Name)
+		log.Debug().Str("user", user.Name).Msgf("got gist %d", len(g))
+		if err != nil {
+			log.Error().Err(err).Str("user", user.Name).Str("type", user.Type).
+				Msg("failed to fetch user gists")
+		} else if len(g) > 0 {
+			a.repositories = append(a.repositories, g...)
+		}
 	}
 }
 
@@ -90,43 +129,113 @@ func (a *analysis) processRepositories(ctx context.Context) {
 	config := *a.config // copy
 	sig := a.signature
 
+	cache := a.newBlobCache(ctx)
+	if cache != nil {
+		defer a.saveBlobCache(ctx, cache)
+	}
+
 	findingC := make(chan finding)
+	scannedC := make(chan scanResult)
 
 	quit := make(chan struct{})
 	defer close(quit)
 
-	// collects any findings
+	// collects any findings, a repository is only sent to scannedC after all of
+	// its findings are received, so the latest commit is saved after them
 	go func() {
 		for {
 			select {
+			case scanned := <-scannedC:
+				repo := scanned.repository
+				if err := a.db.UpsertRepo(ctx, repo); err != nil {
+					log.Error().Err(err).
+						Str("repo", repo.FullName()).
+						Str("commit", repo.LatestCommit).
+						Msg("failed to save latest commit")
+				}
+
+				for hash, refs := range scanned.commitRefs {
+					err := a.db.UpdateFindingRefs(ctx, repo.FullName(),
+						hash.String(), refs)
+					if err != nil {
+						log.Error().Err(err).
+							Str("repo", repo.FullName()).
+							Str("commit", hash.String()).
+							Msg("failed to save finding refs")
+					}
+				}
+
+				for _, status := range scanned.statuses {
+					err := a.db.UpdateFindingStatus(ctx, repo.FullName(),
+						status.fileName, status.matchString,
+						status.commitHash, status.lineNumber, status.present,
+						status.removedIn)
+					if err != nil {
+						log.Error().Err(err).
+							Str("repo", repo.FullName()).
+							Str("filename", status.fileName).
+							Msg("failed to save finding status")
+					}
+				}
 			case f := <-findingC:
-				err := a.db.AddFinding(ctx, f.repository.Name, f.fileName, f.commitHash, f.matches)
-				log.Error().Err(err).
-					Str("repo", f.repository.Name).
-					Str("commit", f.commitHash).
-					Str("filename", f.fileName).
-					Msg("failed to add finding")
+				a.addFinding(ctx, f)
 			case <-quit:
 				return
 			}
 		}
 	}()
 
-	for _, repo := range a.repositories {
+	repos := withUpstreams(a.repositories)
+	if config.WithWiki {
+		repos = withWikis(repos)
+	}
+
+	for _, repo := range repos {
 		if err = sem.Acquire(ctx, 1); err != nil {
 			log.Error().Err(err).Msg("Failed to acquire semaphore")
 			break
 		}
 
 		repo := repo // copy
-		repo.LatestCommit, err = a.db.GetRepoLatestCommit(ctx, repo.Name)
+		repo.LatestCommit, err = a.db.GetRepoLatestCommit(ctx,
+			repo.FullName())
+		if err == nil && (config.AllBranch || config.WithPullRequest) {
+			repo.Refs, err = a.db.GetRepoRefs(ctx, repo.FullName())
+		}
+		var known knownFindings
+		if err == nil && repo.LatestCommit != "" {
+			known, err = a.knownFindings(ctx, repo.FullName())
+		}
+		if err != nil {
+			log.Error().Err(err).Str("repo", repo.FullName()).
+				Msg("failed to get latest scanned commit")
+			sem.Release(1)
+			continue
+		}
+
+		auth := a.cloneAuthConfig(repo)
 
 		// TODO: benchmark this path, currently we only use one goroutine per
 		// repository
 		go func() {
 			defer sem.Release(1)
-			processRepository(repo, config.StorageType, config.StoragePath,
-				config.IgnoreFiles, sig, findingC)
+
+			// directories don't have any commit to compare with
+			if repo.Kind == cgit.KindDirectory {
+				err := processDirectory(repo, &config, sig, cache, findingC)
+				if err == nil {
+					scannedC <- scanResult{repository: repo}
+				}
+				return
+			}
+
+			result, err := processRepository(repo, auth, &config, sig,
+				known, cache, findingC)
+			if err != nil || result.repository.LatestCommit == "" {
+				return
+			}
+
+			scannedC <- result
 		}()
 	}
 
@@ -137,6 +246,209 @@ func (a *analysis) processRepositories(ctx context.Context) {
 	quit <- struct{}{}
 }
 
+// newBlobCache return the blob cache of the analysis, nil if it's disabled. The
+// saved results are loaded with persist_blob_cache
+func (a *analysis) newBlobCache(ctx context.Context) *blobCache {
+	if a.config.BlobCacheSize <= 0 {
+		return nil
+	}
+
+	cache := newBlobCache(a.config.BlobCacheSize)
+	if !a.config.PersistBlobCache {
+		return cache
+	}
+
+	fingerprint := signature.ContentFingerprint(a.signature)
+	if err := cache.load(ctx, a.db, fingerprint); err != nil {
+		log.Error().Err(err).Msg("failed to load blob cache")
+	}
+
+	return cache
+}
+
+// saveBlobCache saves the new blob results with persist_blob_cache
+func (a *analysis) saveBlobCache(ctx context.Context, cache *blobCache) {
+	log.Debug().Int("hits", cache.hits).Int("added", len(cache.added)).
+		Msg("blob cache")
+
+	if !a.config.PersistBlobCache {
+		return
+	}
+
+	fingerprint := signature.ContentFingerprint(a.signature)
+	if err := cache.save(ctx, a.db, fingerprint); err != nil {
+		log.Error().Err(err).Msg("failed to save blob cache")
+	}
+}
+
+// knownFindings return the file matches and the commits of the saved
+// findings of the repository
+func (a *analysis) knownFindings(ctx context.Context,
+	repoName string) (knownFindings, error) {
+	var known knownFindings
+
+	findings, err := a.db.GetRepoFindings(ctx, repoName)
+	if err != nil {
+		return known, err
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		// comments outside of the git history don't have a commit
+		if f.CommitHash != "" && f.URL == "" && !seen[f.CommitHash] {
+			seen[f.CommitHash] = true
+			known.commits = append(known.commits,
+				plumbing.NewHash(f.CommitHash))
+		}
+
+		if !isFileMatch(finding{
+			commitHash: f.CommitHash,
+			fileName:   f.Filename,
+			url:        f.URL,
+		}) {
+			continue
+		}
+
+		known.matches = append(known.matches, findingMatch{
+			fileMatch: fileMatch{
+				fileName:    f.Filename,
+				matchString: f.MatchString,
+			},
+			commitHash: f.CommitHash,
+			lineNumber: f.LineNumber,
+			commitTime: f.CommitTime,
+		})
+	}
+	known.matches = uniqueFindingMatches(known.matches)
+
+	return known, nil
+}
+
+// addFinding saves every match of the finding
+func (a *analysis) addFinding(ctx context.Context, f finding) {
+	for _, match := range f.matches {
+		err := a.db.AddFinding(ctx, database.Finding{
+			RepoName:       f.repository.FullName(),
+			Filename:       f.fileName,
+			SignatureID:    match.SignatureID,
+			CommitHash:     f.commitHash,
+			Refs:           f.refs,
+			Description:    match.Description,
+			MatchString:    match.Substring,
+			LineNumber:     match.LineNumber,
+			Entropy:        match.Entropy,
+			URL:            f.url,
+			AuthorName:     f.author.Name,
+			AuthorEmail:    f.author.Email,
+			CommitterName:  f.committer.Name,
+			CommitterEmail: f.committer.Email,
+			CommitTime:     f.committer.When,
+		})
+		if err != nil {
+			log.Error().Err(err).
+				Str("repo", f.repository.FullName()).
+				Str("commit", f.commitHash).
+				Str("filename", f.fileName).
+				Msg("failed to add finding")
+		}
+	}
+}
+
+// processComments scans the comments of the listed repositories, the comments
+// are not versioned so they're fully scanned every time
+func (a *analysis) processComments(ctx context.Context) {
+	// Blocking request ahead, the comments of a repository could be more than
+	// its repositories listing
+	for _, repo := range a.repositories {
+		// repositories entries are not listed from a service
+		if repo.Kind != cgit.KindRepository || repo.Service == "" {
+			continue
+		}
+
+		comments, err := a.gs.ListRepositoryComments(ctx, repo.Service,
+			repo.Name)
+		if err == gitservice.ErrCommentNotSupported {
+			continue
+		} else if err != nil {
+			log.Error().Err(err).Str("repo", repo.FullName()).
+				Msg("failed to fetch repository comments")
+			continue
+		}
+
+		log.Debug().Str("repo", repo.FullName()).
+			Msgf("got comment %d", len(comments))
+
+		for _, comment := range comments {
+			matches := signature.ExtractMatch(comment.Path, comment.Body,
+				a.signature)
+			if len(matches) == 0 {
+				continue
+			}
+
+			a.addFinding(ctx, finding{
+				repository: repo,
+				commitHash: comment.CommitHash,
+				fileName:   comment.Path,
+				matches:    matches,
+				url:        comment.URL,
+			})
+		}
+	}
+}
+
+// withUpstreams adds the upstream of each fork that isn't in repos, the history
+// shared with the upstream is only scanned in the upstream
+func withUpstreams(repos []cgit.Repository) []cgit.Repository {
+	all := make([]cgit.Repository, 0, len(repos))
+
+	seen := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		seen[repo.FullName()] = true
+	}
+
+	for _, repo := range repos {
+		all = append(all, repo)
+
+		upstream := repo.Upstream
+		if upstream == nil || seen[upstream.FullName()] {
+			continue
+		}
+		seen[upstream.FullName()] = true
+
+		log.Debug().Str("repo", repo.FullName()).
+			Str("upstream", upstream.FullName()).
+			Msg("adding upstream of the fork")
+		all = append(all, *upstream)
+	}
+
+	return all
+}
+
+// withWikis return repos with the wiki repository of each repository that has
+// the wiki enabled
+func withWikis(repos []cgit.Repository) []cgit.Repository {
+	all := make([]cgit.Repository, 0, len(repos))
+
+	for _, repo := range repos {
+		all = append(all, repo)
+		if repo.HasWiki {
+			all = append(all, repo.Wiki())
+		}
+	}
+
+	return all
+}
+
+// cloneAuthConfig return the configured clone credential of the repositories
+// entry or the service of the repository, nil to use the service token
+func (a *analysis) cloneAuthConfig(repo cgit.Repository) *AuthConfig {
+	if auth, ok := a.repoAuths[repo.URL]; ok {
+		return auth
+	}
+
+	return a.serviceAuths[repo.Service]
+}
+
 // Runner run the overall analysis pipeline
 func (a *analysis) Runner() {
 	// should we add timeout?
@@ -147,4 +459,8 @@ func (a *analysis) Runner() {
 	a.processOrganizations(ctx)
 	a.processUsers(ctx)
 	a.processRepositories(ctx)
+
+	if a.config.WithComments {
+		a.processComments(ctx)
+	}
 }
@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// fileMatch is a matched string in a file, the presence of the same file and
+// match string is only checked once in a commit
+type fileMatch struct {
+	fileName    string
+	matchString string
+}
+
+// findingMatch is the fileMatch of a finding, the HEAD status is saved for
+// each finding
+type findingMatch struct {
+	fileMatch
+	commitHash string
+	lineNumber int32
+	// commitTime bounds the search of the removing commit, the match isn't
+	// in the older history. Zero if it's unknown
+	commitTime time.Time
+}
+
+// headStatus is the HEAD status of a findingMatch, removedIn is the commit
+// that removed the match from the HEAD history, empty if it's present at HEAD
+// or it's never in the HEAD history, e.g. a branch that isn't merged
+type headStatus struct {
+	findingMatch
+	present   bool
+	removedIn string
+}
+
+// isFileMatch return true for the findings of a file in the git history,
+// messages and comments are not checked against HEAD
+func isFileMatch(f finding) bool {
+	return f.commitHash != "" && f.url == "" &&
+		!strings.HasPrefix(f.fileName, ":")
+}
+
+// isPathMatch return true if the match string is the file path or name, the
+// match is present as long as the file exists
+func (fm fileMatch) isPathMatch() bool {
+	return fm.matchString == fm.fileName ||
+		fm.matchString == path.Base(fm.fileName)
+}
+
+// uniqueFindingMatches return findingMatches without the duplicates of the
+// same finding
+func uniqueFindingMatches(findingMatches []findingMatch) []findingMatch {
+	type key struct {
+		fileMatch
+		commitHash string
+		lineNumber int32
+	}
+
+	seen := make(map[key]bool, len(findingMatches))
+	unique := findingMatches[:0]
+
+	for _, fm := range findingMatches {
+		k := key{fm.fileMatch, fm.commitHash, fm.lineNumber}
+		if !seen[k] {
+			seen[k] = true
+			unique = append(unique, fm)
+		}
+	}
+
+	return unique
+}
+
+// presence checks fileMatches in commits, the match result of a blob is
+// cached since most files are unchanged between commits
+type presence struct {
+	blobs map[fileMatch]map[plumbing.Hash]bool
+}
+
+func newPresence() *presence {
+	return &presence{blobs: make(map[fileMatch]map[plumbing.Hash]bool)}
+}
+
+// present return true if fm is in the commit tree
+func (p *presence) present(commit *object.Commit, fm fileMatch) (bool, error) {
+	file, err := commit.File(fm.fileName)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if fm.isPathMatch() {
+		return true, nil
+	}
+
+	blobs, ok := p.blobs[fm]
+	if !ok {
+		blobs = make(map[plumbing.Hash]bool)
+		p.blobs[fm] = blobs
+	}
+
+	if found, ok := blobs[file.Hash]; ok {
+		return found, nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return false, err
+	}
+
+	blobs[file.Hash] = strings.Contains(content, fm.matchString)
+	return blobs[file.Hash], nil
+}
+
+// headStatuses checks each findingMatch against the HEAD tree, the first
+// parent history of HEAD is walked once for the matches removed from HEAD. The
+// walk stops once the removing commit of every match is found or the history
+// is older than their commits
+func headStatuses(r *git.Repository, head plumbing.Hash,
+	findingMatches []findingMatch) ([]headStatus, error) {
+	p := newPresence()
+
+	commit, err := r.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]headStatus, len(findingMatches))
+	// removed are the indexes of the statuses without the removing commit yet
+	var removed []int
+	for i, fm := range findingMatches {
+		statuses[i].findingMatch = fm
+		statuses[i].present, err = p.present(commit, fm.fileMatch)
+		if err != nil {
+			return nil, err
+		}
+
+		if !statuses[i].present {
+			removed = append(removed, i)
+		}
+	}
+
+	// the child of the first commit with the match is the removing commit
+	child := commit
+	for len(removed) > 0 {
+		commit, err = child.Parent(0)
+		if errors.Is(err, object.ErrParentNotFound) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		n := 0
+		for _, i := range removed {
+			// the finding commit isn't in the first parent history, e.g. a
+			// branch that isn't merged
+			if commit.Committer.When.Before(statuses[i].commitTime) {
+				continue
+			}
+
+			found, err := p.present(commit, statuses[i].fileMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			if found {
+				statuses[i].removedIn = child.Hash.String()
+				continue
+			}
+
+			// the match is added in its commit, it's not in the parents
+			if commit.Hash.String() == statuses[i].commitHash {
+				continue
+			}
+
+			removed[n] = i
+			n++
+		}
+		removed = removed[:n]
+
+		child = commit
+	}
+
+	return statuses, nil
+}
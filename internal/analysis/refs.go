@@ -0,0 +1,337 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// branchRefSpec fetch every remote branch, clone already does this
+	branchRefSpec = gitconfig.RefSpec("+refs/heads/*:refs/remotes/origin/*")
+
+	// pullRequestRefSpecs fetch pull request refs (github) and merge request
+	// refs (gitlab), they are not fetched by default
+	pullRequestRefSpecs = []gitconfig.RefSpec{
+		"+refs/pull/*/head:refs/pull/*/head",
+		"+refs/merge-requests/*/head:refs/merge-requests/*/head",
+	}
+
+	// upstreamRemote is the remote of the upstream of a fork, its branches are
+	// fetched to upstreamRefPrefix, outside of refs/remotes so they're not
+	// scanned as the fork branches
+	upstreamRemote    = "upstream"
+	upstreamRefPrefix = "refs/upstream/"
+	upstreamRefSpec   = gitconfig.RefSpec("+refs/heads/*:" +
+		upstreamRefPrefix + "*")
+)
+
+// listRefs return the HEAD commit and the commit of each ref to scan. HEAD is
+// always included, allBranch includes branches (local and remote) and tags,
+// withPullRequest includes the fetched pull request refs
+func listRefs(r *git.Repository, allBranch, withPullRequest bool) (
+	plumbing.Hash, map[string]plumbing.Hash, error) {
+	tips := make(map[string]plumbing.Hash)
+
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	tips[head.Name().String()] = head.Hash()
+
+	refs, err := r.References()
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		// e.g. refs/remotes/origin/HEAD
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		name := ref.Name()
+		switch {
+		case allBranch && (name.IsBranch() || name.IsRemote() || name.IsTag()):
+		case withPullRequest && isPullRequestRef(name):
+		default:
+			return nil
+		}
+
+		hash, err := peelToCommit(r, ref.Hash())
+		if err != nil {
+			// tags could point to a non commit object, skip them
+			return nil
+		}
+
+		tips[name.String()] = hash
+		return nil
+	})
+
+	return head.Hash(), tips, err
+}
+
+func isPullRequestRef(name plumbing.ReferenceName) bool {
+	return strings.HasPrefix(name.String(), "refs/pull/") ||
+		strings.HasPrefix(name.String(), "refs/merge-requests/")
+}
+
+// peelToCommit return the commit hash pointed by hash, annotated tags are
+// followed to their commit
+func peelToCommit(r *git.Repository, hash plumbing.Hash) (plumbing.Hash,
+	error) {
+	if _, err := r.CommitObject(hash); err == nil {
+		return hash, nil
+	}
+
+	tag, err := r.TagObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return commit.Hash, nil
+}
+
+// markRefs marks all commits reachable from the refs with the name prefix as
+// seen, e.g. the fetched upstream branches
+func markRefs(r *git.Repository, prefix string,
+	seen map[plumbing.Hash]bool) error {
+	refs, err := r.References()
+	if err != nil {
+		return err
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference ||
+			!strings.HasPrefix(ref.Name().String(), prefix) {
+			return nil
+		}
+
+		return markAncestors(r, ref.Hash(), seen)
+	})
+}
+
+// markAncestors marks all commits reachable from hash, including itself, as
+// seen
+func markAncestors(r *git.Repository, hash plumbing.Hash,
+	seen map[plumbing.Hash]bool) error {
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	return object.NewCommitPreorderIter(commit, seen, nil).
+		ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+}
+
+// newCommits return the commits reachable from tips but not from scanned, each
+// commit is returned once along with the names of the refs it's reachable from
+func newCommits(r *git.Repository, tips map[string]plumbing.Hash,
+	scanned map[plumbing.Hash]bool) ([]*object.Commit,
+	map[plumbing.Hash][]string, error) {
+	var commits []*object.Commit
+
+	names := make([]string, 0, len(tips))
+	for name := range tips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the history is walked once, each walk stops at the commits already
+	// walked from the previous refs
+	seen := make(map[plumbing.Hash]bool, len(scanned))
+	for hash := range scanned {
+		seen[hash] = true
+	}
+
+	tipRefs := make(map[plumbing.Hash][]string)
+	for _, name := range names {
+		tip, err := r.CommitObject(tips[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		tipRefs[tip.Hash] = append(tipRefs[tip.Hash], name)
+
+		err = object.NewCommitPreorderIter(tip, seen, nil).
+			ForEach(func(c *object.Commit) error {
+				seen[c.Hash] = true
+				commits = append(commits, c)
+				return nil
+			})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return commits, reachableRefs(commits, tipRefs), nil
+}
+
+// reachableRefs propagates the ref names of tipRefs from the children to the
+// parents of commits, a commit is reachable from the refs of its children and
+// of itself. The parents outside of commits are already scanned
+func reachableRefs(commits []*object.Commit,
+	tipRefs map[plumbing.Hash][]string) map[plumbing.Hash][]string {
+	// pending is the number of children of a commit not visited yet
+	pending := make(map[plumbing.Hash]int, len(commits))
+	for _, c := range commits {
+		for _, parent := range c.ParentHashes {
+			pending[parent]++
+		}
+	}
+
+	var queue []*object.Commit
+	byHash := make(map[plumbing.Hash]*object.Commit, len(commits))
+	for _, c := range commits {
+		byHash[c.Hash] = c
+		if pending[c.Hash] == 0 {
+			queue = append(queue, c)
+		}
+	}
+
+	// a commit is visited once all of its children are visited
+	children := make(map[plumbing.Hash][][]string)
+	reachable := make(map[plumbing.Hash][]string, len(commits))
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		refs := unionRefs(append(children[c.Hash], tipRefs[c.Hash]))
+		reachable[c.Hash] = refs
+		delete(children, c.Hash)
+
+		for _, hash := range c.ParentHashes {
+			parent, ok := byHash[hash]
+			if !ok {
+				continue
+			}
+
+			children[hash] = append(children[hash], refs)
+			if pending[hash]--; pending[hash] == 0 {
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return reachable
+}
+
+// unionRefs return the sorted union of the ref names, a single list is
+// returned as it is so linear histories share the same list
+func unionRefs(lists [][]string) []string {
+	var nonEmpty [][]string
+	for _, list := range lists {
+		if len(list) > 0 {
+			nonEmpty = append(nonEmpty, list)
+		}
+	}
+
+	switch len(nonEmpty) {
+	case 0:
+		return nil
+	case 1:
+		return nonEmpty[0]
+	}
+
+	seen := make(map[string]bool)
+	var union []string
+	for _, list := range nonEmpty {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				union = append(union, name)
+			}
+		}
+	}
+	sort.Strings(union)
+
+	return union
+}
+
+// refsChanged return true if tips are different from the saved refs of the
+// previous analysis
+func refsChanged(tips map[string]plumbing.Hash, saved map[string]string) bool {
+	if len(tips) != len(saved) {
+		return true
+	}
+
+	for name, hash := range tips {
+		if saved[name] != hash.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// commitRefs return the names of the tips each of commits is reachable from,
+// e.g. the commits of the saved findings when a ref is added or moved. The
+// history is walked once, then only the descendants of commits are visited
+func commitRefs(r *git.Repository, tips map[string]plumbing.Hash,
+	commits []plumbing.Hash) (map[plumbing.Hash][]string, error) {
+	tipRefs := make(map[plumbing.Hash][]string)
+	for name, hash := range tips {
+		tipRefs[hash] = append(tipRefs[hash], name)
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	children := make(map[plumbing.Hash][]plumbing.Hash)
+	for hash := range tipRefs {
+		tip, err := r.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		err = object.NewCommitPreorderIter(tip, seen, nil).
+			ForEach(func(c *object.Commit) error {
+				seen[c.Hash] = true
+				for _, parent := range c.ParentHashes {
+					children[parent] = append(children[parent], c.Hash)
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refs := make(map[plumbing.Hash][]string, len(commits))
+	for _, commit := range commits {
+		// not reachable from any ref anymore, e.g. a deleted branch
+		if !seen[commit] {
+			refs[commit] = nil
+			continue
+		}
+
+		var names []string
+		visited := map[plumbing.Hash]bool{commit: true}
+		queue := []plumbing.Hash{commit}
+		for len(queue) > 0 {
+			hash := queue[0]
+			queue = queue[1:]
+
+			names = append(names, tipRefs[hash]...)
+			for _, child := range children[hash] {
+				if !visited[child] {
+					visited[child] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+		sort.Strings(names)
+		refs[commit] = names
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+// DefaultStreamChunkSize is the default max size of a stream read
+const DefaultStreamChunkSize = 1 << 20
+
+// streamOverlapLines is the max number of the last lines of a chunk scanned
+// again with the next chunk, enough for a PEM encoded 4096 bits private key
+const streamOverlapLines = 64
+
+// ScanStream scans r with the content signatures as it's read and calls fn
+// with every match, the line numbers are one based from the start of r like
+// the other report formats. Chunks are cut at the last newline and their last
+// lines, up to streamOverlapLines lines and chunkSize bytes, are scanned again
+// with the next chunk, so a multi-line match such as a private key is found
+// across two chunks. A longer multi-line match could still be missed, and a
+// line longer than chunkSize is split
+// revive:disable-next-line:line-length-limit
+func ScanStream(r io.Reader, chunkSize int, signatures []signature.Base, fn func(signature.Match) error) error {
+	// pending are the read lines not scanned yet, prefixed by the overlap
+	// lines of the previous chunk. The last line could continue in the next
+	// read
+	var pending []byte
+	// overlap is the size of the overlap lines at the start of pending
+	var overlap int
+	// lineNumber is the zero based line number of the first pending line
+	var lineNumber int32
+
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(chunk)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		pending = append(pending, chunk[:n]...)
+
+		end := len(pending)
+		if !eof {
+			if i := bytes.LastIndexByte(pending[overlap:], '\n'); i >= 0 {
+				end = overlap + i + 1
+			} else if len(pending)-overlap < chunkSize {
+				continue
+			}
+		}
+
+		// there isn't any new line since the previous chunk
+		if end == overlap {
+			return nil
+		}
+
+		// the matches within the overlap lines are found in the previous
+		// chunk
+		overlapLines := int32(bytes.Count(pending[:overlap], []byte{'\n'}))
+
+		content := string(pending[:end])
+		for _, match := range signature.ExtractContentMatch(content,
+			signatures) {
+			lastLine := match.LineNumber + int32(strings.Count(
+				strings.TrimRight(match.Substring, "\n"), "\n"))
+			if lastLine < overlapLines {
+				continue
+			}
+
+			match.LineNumber += lineNumber + 1
+			if err = fn(match); err != nil {
+				return err
+			}
+		}
+
+		if eof {
+			return nil
+		}
+
+		// a split line isn't carried over, its rest is in the next chunk
+		start := end
+		if pending[end-1] == '\n' {
+			start = overlapStart(pending[:end], chunkSize)
+		}
+		lineNumber += int32(bytes.Count(pending[:start], []byte{'\n'}))
+
+		pending = pending[:copy(pending, pending[start:])]
+		overlap = end - start
+	}
+}
+
+// overlapStart return the start of the last lines of content scanned again
+// with the next chunk, at most streamOverlapLines lines and maxSize bytes.
+// content ends with a newline
+func overlapStart(content []byte, maxSize int) int {
+	start := len(content)
+	for n := 0; n < streamOverlapLines && start > 0; n++ {
+		// the line ends with the newline before start
+		i := bytes.LastIndexByte(content[:start-1], '\n') + 1
+		if len(content)-i > maxSize {
+			break
+		}
+		start = i
+	}
+
+	return start
+}
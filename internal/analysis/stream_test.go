@@ -0,0 +1,85 @@
+package analysis_test
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/circleous/gitseer/internal/analysis"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+func TestScanStream(t *testing.T) {
+	var log strings.Builder
+	for i := 0; i < 50; i++ {
+		log.WriteString("building step\n")
+	}
+	log.WriteString("password = \"first\"\nok\npassword = \"second\"")
+
+	tests := []struct {
+		name      string
+		r         io.Reader
+		chunkSize int
+	}{
+		// every chunk ends in the middle of a line
+		{"one byte reads",
+			iotest.OneByteReader(strings.NewReader(log.String())), 32},
+		{"single chunk", strings.NewReader(log.String()),
+			analysis.DefaultStreamChunkSize},
+	}
+
+	for _, tt := range tests {
+		var matches []signature.Match
+		err := analysis.ScanStream(tt.r, tt.chunkSize, hookSignatures,
+			func(match signature.Match) error {
+				matches = append(matches, match)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("%s: failed to scan stream, %v", tt.name, err)
+		}
+
+		if len(matches) != 2 ||
+			matches[0].LineNumber != 51 || matches[1].LineNumber != 53 ||
+			matches[1].Substring != `password = "second"` {
+			t.Errorf("%s: unexpected matches %+v", tt.name, matches)
+		}
+	}
+}
+
+func TestScanStreamMultiLine(t *testing.T) {
+	pattern := `-----BEGIN KEY-----[\s\S]*?-----END KEY-----`
+	sigs := []signature.Base{{
+		Type:        "content",
+		ID:          "private_key",
+		Description: "Private key",
+		Enable:      true,
+		MatchString: pattern,
+		Match:       regexp.MustCompile(pattern),
+	}}
+
+	var log strings.Builder
+	for i := 0; i < 10; i++ {
+		log.WriteString("building step\n")
+	}
+	log.WriteString("-----BEGIN KEY-----\nAAAA\nBBBB\n-----END KEY-----\nok\n")
+
+	// the key is split across the chunks
+	var matches []signature.Match
+	err := analysis.ScanStream(iotest.OneByteReader(
+		strings.NewReader(log.String())), 64, sigs,
+		func(match signature.Match) error {
+			matches = append(matches, match)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("failed to scan stream, %v", err)
+	}
+
+	// the key starts at the 11th line
+	if len(matches) != 1 || matches[0].LineNumber != 11 {
+		t.Errorf("unexpected matches %+v", matches)
+	}
+}
@@ -2,61 +2,291 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/circleous/gitseer/pkg/git"
-	"github.com/circleous/gitseer/pkg/signature"
 )
 
+// refsSeparator joins the refs of a finding, git doesn't allow spaces in ref
+// names
+const refsSeparator = " "
+
 func (db *databaseConnection) GetRepoLatestCommit(ctx context.Context,
 	repoName string) (string, error) {
-	var hash string
+	var hash sql.NullString
 	err := db.conn.QueryRowContext(ctx,
 		`SELECT last_commit FROM analysis WHERE repo_name = ? LIMIT 1`,
 		repoName).Scan(&hash)
-	return hash, err
+	// never scanned before
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash.String, err
+}
+
+func (db *databaseConnection) GetRepoRefs(ctx context.Context,
+	repoName string) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT ref_name, last_commit FROM refs WHERE repo_name = ?`, repoName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, hash string
+		if err = rows.Scan(&name, &hash); err != nil {
+			return nil, err
+		}
+		refs[name] = hash
+	}
+
+	return refs, rows.Err()
 }
 
 func (db *databaseConnection) UpsertRepo(ctx context.Context,
 	repo git.Repository) error {
-	_, err := db.conn.ExecContext(ctx, `
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO analysis (
-			repo_name, last_commit
+			repo_name, last_commit, kind
 		) 
-		VALUES (?, ?)
+		VALUES (?, ?, ?)
 		ON CONFLICT (repo_name) DO UPDATE SET
-			last_commit = excluded.last_commit`,
-		repo.Name, repo.LatestCommit)
+			last_commit = excluded.last_commit,
+			kind = excluded.kind`,
+		repo.FullName(), repo.LatestCommit, repo.Kind)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for name, hash := range repo.Refs {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO refs (
+				repo_name, ref_name, last_commit
+			)
+			VALUES (?, ?, ?)
+			ON CONFLICT (repo_name, ref_name) DO UPDATE SET
+				last_commit = excluded.last_commit`,
+			repo.FullName(), name, hash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddFinding adds a finding, the same match string of a signature in the same
+// line, file and commit is only added once
+func (db *databaseConnection) AddFinding(ctx context.Context, f Finding) error {
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT OR IGNORE INTO findings (
+			repo_name, filename, signature_id, commit_hash, refs,
+			description, match_string, line_num, entropy, url,
+			author_name, author_email, committer_name, committer_email,
+			commit_time, created_at
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		f.RepoName, f.Filename, f.SignatureID, f.CommitHash,
+		strings.Join(f.Refs, refsSeparator), f.Description, f.MatchString,
+		f.LineNumber, f.Entropy, f.URL, f.AuthorName, f.AuthorEmail,
+		f.CommitterName, f.CommitterEmail,
+		sql.NullTime{Time: f.CommitTime, Valid: !f.CommitTime.IsZero()},
+		time.Now(),
+	)
+
 	return err
 }
 
-func (db *databaseConnection) AddFinding(ctx context.Context,
-	repoName, filename string, commitHash string, matches []signature.Match) error {
-	var err error
+func (db *databaseConnection) GetRepos(ctx context.Context) ([]git.Repository,
+	error) {
+	var repos []git.Repository
 
-	if len(matches) == 0 {
-		// return errors.New("nothing to add")
-		return nil
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT repo_name, last_commit, kind FROM analysis ORDER BY repo_name`)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	currentDate := time.Now()
+	for rows.Next() {
+		var repo git.Repository
+		var lastCommit, kind sql.NullString
+
+		if err = rows.Scan(&repo.Name, &lastCommit, &kind); err != nil {
+			return nil, err
+		}
+		repo.LatestCommit = lastCommit.String
+		repo.Kind = kind.String
+
+		repos = append(repos, repo)
+	}
 
-	for _, match := range matches {
-		_, err = db.conn.ExecContext(ctx, `
-			INSERT INTO findings (
-				repo_name, filename, signature_id, commit_hash,
-				description, match_string, line_num, created_at
-			) VALUES (?,?,?,?,?,?)`,
-			repoName, filename, match.SignatureID, commitHash,
-			match.Description, match.Substring, match.LineNumber, currentDate,
-		)
+	return repos, rows.Err()
+}
+
+// findingColumns are the selected columns of scanFindings
+const findingColumns = `
+	repo_name, filename, signature_id, commit_hash, refs,
+	description, match_string, line_num, entropy, url,
+	author_name, author_email, committer_name, committer_email,
+	commit_time, present_at_head, removed_in, created_at`
+
+func (db *databaseConnection) GetFindings(ctx context.Context) ([]Finding,
+	error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+findingColumns+`
+		FROM findings
+		ORDER BY repo_name, commit_hash, signature_id, filename, line_num`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFindings(rows)
+}
+
+func (db *databaseConnection) GetRepoFindings(ctx context.Context,
+	repoName string) ([]Finding, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+findingColumns+`
+		FROM findings
+		WHERE repo_name = ?`, repoName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFindings(rows)
+}
+
+// scanFindings reads the findingColumns of every row
+func scanFindings(rows *sql.Rows) ([]Finding, error) {
+	var findings []Finding
+
+	for rows.Next() {
+		var f Finding
+		var refs, url, authorName, authorEmail sql.NullString
+		var committerName, committerEmail, removedIn sql.NullString
+		var entropy sql.NullFloat64
+		var commitTime sql.NullTime
+		var presentAtHead sql.NullBool
+
+		err := rows.Scan(&f.RepoName, &f.Filename, &f.SignatureID,
+			&f.CommitHash, &refs, &f.Description, &f.MatchString,
+			&f.LineNumber, &entropy, &url, &authorName, &authorEmail,
+			&committerName, &committerEmail, &commitTime, &presentAtHead,
+			&removedIn, &f.CreatedAt)
 		if err != nil {
-			break
+			return nil, err
 		}
+		f.Refs = strings.Fields(refs.String)
+		f.Entropy = entropy.Float64
+		f.URL = url.String
+		f.AuthorName = authorName.String
+		f.AuthorEmail = authorEmail.String
+		f.CommitterName = committerName.String
+		f.CommitterEmail = committerEmail.String
+		f.CommitTime = commitTime.Time
+		if presentAtHead.Valid {
+			f.PresentAtHead = &presentAtHead.Bool
+		}
+		f.RemovedIn = removedIn.String
+
+		findings = append(findings, f)
 	}
 
+	return findings, rows.Err()
+}
+
+func (db *databaseConnection) UpdateFindingRefs(ctx context.Context,
+	repoName, commitHash string, refs []string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE findings SET refs = ?
+		WHERE repo_name = ? AND commit_hash = ?`,
+		strings.Join(refs, refsSeparator), repoName, commitHash)
+
+	return err
+}
+
+func (db *databaseConnection) UpdateFindingStatus(ctx context.Context,
+	repoName, filename, matchString, commitHash string, lineNumber int32,
+	present bool, removedIn string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE findings SET present_at_head = ?, removed_in = ?
+		WHERE repo_name = ? AND filename = ? AND match_string = ?
+			AND commit_hash = ? AND line_num = ?`,
+		present, removedIn, repoName, filename, matchString, commitHash,
+		lineNumber)
+
 	return err
 }
 
-// func (db *databaseConnection) GetLatestFinding(ctx context.Context,
-// 	relTime *time.Time)
+func (db *databaseConnection) GetBlobs(ctx context.Context,
+	fingerprint string) (map[string]string, error) {
+	blobs := make(map[string]string)
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT blob_key, result FROM blobs WHERE fingerprint = ?`,
+		fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var result sql.NullString
+		if err = rows.Scan(&key, &result); err != nil {
+			return nil, err
+		}
+		blobs[key] = result.String
+	}
+
+	return blobs, rows.Err()
+}
+
+func (db *databaseConnection) AddBlobs(ctx context.Context, fingerprint string,
+	blobs map[string]string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// results of the other signatures are stale
+	_, err = tx.ExecContext(ctx, `DELETE FROM blobs WHERE fingerprint != ?`,
+		fingerprint)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO blobs (
+			blob_key, fingerprint, result
+		) VALUES (?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for key, result := range blobs {
+		if _, err = stmt.ExecContext(ctx, key, fingerprint, result); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
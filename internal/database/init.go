@@ -3,30 +3,130 @@ package database
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 
 	// for database/sql
 	_ "github.com/mattn/go-sqlite3"
 
-	"github.com/circleous/gitseer/pkg/signature"
+	"github.com/circleous/gitseer/pkg/git"
 )
 
+// MemoryURI is the URI of an in-memory database, the findings are gone once
+// it's closed
+const MemoryURI = ":memory:"
+
+// findingsKey is the unique key of the findings, every match of a signature in
+// the same file and commit is a separate finding
+const findingsKey = "UNIQUE(signature_id,repo_name,commit_hash,filename," +
+	"line_num,match_string)"
+
+// addedColumns are the columns added after the initial schema, existing
+// databases are migrated in place
+var addedColumns = []struct{ table, name, definition string }{
+	{"findings", "entropy", "REAL"},
+	{"findings", "refs", "TEXT"},
+	{"analysis", "kind", "VARCHAR(16)"},
+	{"findings", "url", "TEXT"},
+	{"findings", "author_name", "TEXT"},
+	{"findings", "author_email", "TEXT"},
+	{"findings", "committer_name", "TEXT"},
+	{"findings", "committer_email", "TEXT"},
+	{"findings", "commit_time", "TIMESTAMP"},
+	{"findings", "present_at_head", "BOOLEAN"},
+	{"findings", "removed_in", "VARCHAR(40)"},
+}
+
 type databaseConnection struct {
 	conn *sql.DB
 }
 
+// Finding is a single row of the findings table
+type Finding struct {
+	// RepoName is the repository full name, see git.Repository.FullName
+	RepoName    string
+	Filename    string
+	SignatureID string
+	CommitHash  string
+	// Refs are the refs the commit is reachable from when it's scanned
+	Refs        []string
+	Description string
+	MatchString string
+	LineNumber  int32
+	Entropy     float64
+	// URL links back to the finding outside of the git history, e.g. an
+	// issue comment
+	URL string
+	// AuthorName, AuthorEmail, CommitterName and CommitterEmail are the
+	// commit author and committer, both are the tagger of a tag message
+	// finding
+	AuthorName     string
+	AuthorEmail    string
+	CommitterName  string
+	CommitterEmail string
+	// CommitTime is the committer time, zero for the findings outside of the
+	// git history
+	CommitTime time.Time
+	// PresentAtHead is true if the match is still in the file at HEAD, nil if
+	// it's unknown, e.g. the findings outside of the files
+	PresentAtHead *bool
+	// RemovedIn is the commit that removed the match from the HEAD history
+	RemovedIn string
+	CreatedAt time.Time
+}
+
 // Service is the main interface for database package
 type Service interface {
 	Initialize() error
 	Close()
 
-	AddFinding(ctx context.Context, repoName, filename string, commitHash string, matches []signature.Match) error
+	AddFinding(ctx context.Context, f Finding) error
+	// GetRepoLatestCommit return the last scanned commit of the repository, or
+	// empty string if it's never scanned. repoName is the repository full
+	// name, see git.Repository.FullName
 	GetRepoLatestCommit(ctx context.Context, repoName string) (string, error)
+	// GetRepoRefs return the last scanned commit of each ref of the repository
+	GetRepoRefs(ctx context.Context, repoName string) (map[string]string, error)
+	// UpsertRepo saves repo.LatestCommit and repo.Refs as the last scanned
+	// commits of repo.FullName(), along with repo.Kind
+	UpsertRepo(ctx context.Context, repo git.Repository) error
+
+	// GetRepos return all analyzed repositories with their kind, the names are
+	// the full names
+	GetRepos(ctx context.Context) ([]git.Repository, error)
+	// GetFindings return all findings ordered by repository, commit and
+	// signature
+	GetFindings(ctx context.Context) ([]Finding, error)
+	// GetRepoFindings return the findings of the repository, repoName is the
+	// repository full name
+	GetRepoFindings(ctx context.Context, repoName string) ([]Finding, error)
+	// UpdateFindingRefs saves refs as the refs of every finding of the
+	// commit in the repository
+	// revive:disable-next-line:line-length-limit
+	UpdateFindingRefs(ctx context.Context, repoName, commitHash string, refs []string) error
+	// UpdateFindingStatus saves the HEAD status of the finding of the match
+	// string in the file, commit and line of the repository
+	// revive:disable-next-line:line-length-limit
+	UpdateFindingStatus(ctx context.Context, repoName, filename, matchString, commitHash string, lineNumber int32, present bool, removedIn string) error
+
+	// GetBlobs return the cached blob scan results of the content signatures
+	// fingerprint keyed by the blob key
+	GetBlobs(ctx context.Context, fingerprint string) (map[string]string, error)
+	// AddBlobs saves the blob scan results of the fingerprint, the results of
+	// the other fingerprints are removed
+	// revive:disable-next-line:line-length-limit
+	AddBlobs(ctx context.Context, fingerprint string, blobs map[string]string) error
 }
 
 // NewDatabase create a new connection to database
 func NewDatabase(dbURI string) (Service, error) {
 	conn, err := sql.Open("sqlite3", dbURI)
 
+	// every connection has its own in-memory database
+	if err == nil && dbURI == MemoryURI {
+		conn.SetMaxOpenConns(1)
+	}
+
 	return &databaseConnection{
 		conn: conn,
 	}, err
@@ -54,8 +154,51 @@ func (dbc *databaseConnection) Initialize() error {
 	// 	return err
 	// }
 
+	if err = dbc.createFindings("findings"); err != nil {
+		return err
+	}
+
 	_, err = dbc.conn.Exec(`
-		CREATE TABLE IF NOT EXISTS findings(
+		CREATE TABLE IF NOT EXISTS refs(
+			id INTEGER PRIMARY KEY,
+			repo_name VARCHAR(275) NOT NULL,
+			ref_name TEXT NOT NULL,
+			last_commit VARCHAR(40),
+			UNIQUE(repo_name,ref_name)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// blobs are the content scan results of the blob cache, result is JSON
+	// encoded by the analysis
+	_, err = dbc.conn.Exec(`
+		CREATE TABLE IF NOT EXISTS blobs(
+			blob_key VARCHAR(81) NOT NULL,
+			fingerprint VARCHAR(40) NOT NULL,
+			result TEXT,
+			UNIQUE(blob_key,fingerprint)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range addedColumns {
+		err = dbc.addColumn(column.table, column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dbc.migrateFindingsKey()
+}
+
+// createFindings creates the findings table with the initial schema as table
+func (dbc *databaseConnection) createFindings(table string) error {
+	_, err := dbc.conn.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + table + `(
 			id INTEGER PRIMARY KEY,
 			repo_name VARCHAR(255),
 			signature_id VARCHAR(40),
@@ -65,14 +208,90 @@ func (dbc *databaseConnection) Initialize() error {
 			match_string TEXT,
 			line_num INTEGER,
 			created_at TIMESTAMP,
-			UNIQUE(signature_id,repo_name,commit_hash,filename)
+			` + findingsKey + `
 		);
 	`)
+
+	return err
+}
+
+// migrateFindingsKey rebuilds the findings table of the databases created with
+// the unique key of signature, repository, commit and file, which only kept
+// one match of a signature in a file
+func (dbc *databaseConnection) migrateFindingsKey() error {
+	var schema string
+	err := dbc.conn.QueryRow(`
+		SELECT sql FROM sqlite_master
+		WHERE type = 'table' AND name = 'findings'`).Scan(&schema)
 	if err != nil {
 		return err
 	}
+	if strings.Contains(schema, findingsKey) {
+		return nil
+	}
+
+	// a previous migration could be interrupted before the rename
+	_, err = dbc.conn.Exec(`DROP TABLE IF EXISTS findings_migrate`)
+	if err != nil {
+		return err
+	}
+	if err = dbc.createFindings("findings_migrate"); err != nil {
+		return err
+	}
+	for _, column := range addedColumns {
+		if column.table != "findings" {
+			continue
+		}
+		err = dbc.addColumn("findings_migrate", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := dbc.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`INSERT INTO findings_migrate (id, ` + findingColumns + `)
+		SELECT id, ` + findingColumns + ` FROM findings`,
+		`DROP TABLE findings`,
+		`ALTER TABLE findings_migrate RENAME TO findings`,
+	} {
+		if _, err = tx.Exec(query); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addColumn adds a column to table if it's not exists yet
+func (dbc *databaseConnection) addColumn(table, name, definition string) error {
+	rows, err := dbc.conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return err
+		}
+		if column == name {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 
-	return nil
+	_, err = dbc.conn.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + name +
+		` ` + definition)
+	return err
 }
 
 func (dbc *databaseConnection) Close() {
@@ -0,0 +1,77 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/circleous/gitseer/internal/database"
+)
+
+func TestMigrateFindingsKey(t *testing.T) {
+	dbURI := filepath.Join(t.TempDir(), "gitseer.db")
+
+	// the findings table before every match in a file was kept
+	conn, err := sql.Open("sqlite3", dbURI)
+	if err != nil {
+		t.Fatalf("failed to open database, %v", err)
+	}
+	_, err = conn.Exec(`
+		CREATE TABLE findings(
+			id INTEGER PRIMARY KEY,
+			repo_name VARCHAR(255),
+			signature_id VARCHAR(40),
+			commit_hash VARCHAR(40),
+			filename TEXT,
+			description TEXT,
+			match_string TEXT,
+			line_num INTEGER,
+			created_at TIMESTAMP,
+			UNIQUE(signature_id,repo_name,commit_hash,filename)
+		);
+		INSERT INTO findings (
+			repo_name, signature_id, commit_hash, filename, description,
+			match_string, line_num, created_at
+		) VALUES ('repo', 'password', 'a', '.env', '', 'old', 0,
+			CURRENT_TIMESTAMP);
+	`)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to create findings table, %v", err)
+	}
+
+	db, err := database.NewDatabase(dbURI)
+	if err != nil {
+		t.Fatalf("failed to open database, %v", err)
+	}
+	defer db.Close()
+
+	if err = db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database, %v", err)
+	}
+
+	ctx := context.Background()
+	for _, f := range []database.Finding{
+		{LineNumber: 1, MatchString: "first"},
+		{LineNumber: 2, MatchString: "second"},
+		// the same match is only added once
+		{LineNumber: 2, MatchString: "second"},
+	} {
+		f.RepoName, f.SignatureID, f.CommitHash, f.Filename =
+			"repo", "password", "a", ".env"
+		if err = db.AddFinding(ctx, f); err != nil {
+			t.Fatalf("failed to add finding, %v", err)
+		}
+	}
+
+	findings, err := db.GetFindings(ctx)
+	if err != nil {
+		t.Fatalf("failed to get findings, %v", err)
+	}
+
+	if len(findings) != 3 || findings[0].MatchString != "old" ||
+		findings[2].MatchString != "second" {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+}
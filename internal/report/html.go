@@ -0,0 +1,63 @@
+package report
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlTemplate is a self-contained page, no external stylesheet or script
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>gitseer report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; border-bottom: 1px solid #e1e4e8; padding-bottom: .3em; }
+h3 { font-size: 1em; font-family: monospace; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1em; }
+th, td { border: 1px solid #e1e4e8; padding: .3em .6em; text-align: left;
+  vertical-align: top; }
+th { background: #f6f8fa; }
+code { white-space: pre-wrap; word-break: break-all; }
+.meta { color: #6a737d; }
+.live { color: #cb2431; }
+</style>
+</head>
+<body>
+<h1>gitseer report</h1>
+<p class="meta">Generated at {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}},
+{{.Total}} finding(s) in {{len .Repositories}} repository(s),
+{{.PresentAtHead}} still present at HEAD.</p>
+{{range .Repositories}}{{$repo := .}}
+<h2>{{.Name}}{{with .Kind}} <span class="meta">({{.}})</span>{{end}}</h2>
+{{if .LatestCommit}}<p class="meta">Latest commit {{.LatestCommit}}</p>{{end}}
+{{range .Commits}}
+<h3>{{if .Hash}}{{.Hash}}{{else if eq $repo.Kind "directory"}}Files{{else}}Comments{{end}}</h3>
+{{with .Refs}}<p class="meta">Reachable from {{range $i, $ref := .}}{{if $i}}, {{end}}{{$ref}}{{end}}</p>{{end}}
+<table>
+<tr><th>Signature</th><th>File</th><th>Line</th><th>Match</th><th>Author</th><th>Committed</th><th>HEAD</th></tr>
+{{range .Signatures}}{{$sig := .}}{{range .Findings}}
+<tr>
+<td title="{{$sig.ID}}">{{$sig.Description}}</td>
+<td>{{if .URL}}<a href="{{.URL}}">{{.Filename}}</a>{{else}}{{.Filename}}{{end}}</td>
+<td>{{.LineNumber}}</td>
+<td><code>{{.MatchString}}</code></td>
+<td{{if .CommitterName}} title="Committed by {{.CommitterName}} <{{.CommitterEmail}}>"{{end}}>{{.AuthorName}}{{with .AuthorEmail}} &lt;{{.}}&gt;{{end}}</td>
+<td>{{with .CommitTime}}{{.Format "2006-01-02 15:04:05 -0700"}}{{end}}</td>
+<td>{{if .IsPresentAtHead}}<strong class="live">present</strong>{{else if .IsRemoved}}removed{{with .RemovedIn}} in <code>{{.}}</code>{{end}}{{end}}</td>
+</tr>
+{{end}}{{end}}
+</table>
+{{end}}
+{{else}}
+<p>No findings.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, r *Report) error {
+	return htmlTemplate.Execute(w, r)
+}
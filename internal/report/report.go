@@ -0,0 +1,238 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circleous/gitseer/internal/database"
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+const (
+	// JSON report file type
+	JSON = "json"
+	// HTML report file type
+	HTML = "html"
+	// SARIF report file type
+	SARIF = "sarif"
+)
+
+var (
+	// ErrInvalidFormat errors for unknown report file type
+	ErrInvalidFormat = errors.New("invalid report file type")
+)
+
+// Report is the findings document, grouped by repository, commit and signature
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Total       int       `json:"total"`
+	// PresentAtHead is the number of findings still present at HEAD, live
+	// exposures are prioritized over the historical ones
+	PresentAtHead int          `json:"present_at_head"`
+	Repositories  []Repository `json:"repositories"`
+
+	// Signatures are the loaded signatures, used by file types that describe
+	// the rules along with the results
+	Signatures []signature.Base `json:"-"`
+}
+
+// Repository holds the findings of one repository
+type Repository struct {
+	Name string `json:"name"`
+	// Kind is empty for a regular repository, else the kind, e.g. gist
+	Kind         string   `json:"kind,omitempty"`
+	LatestCommit string   `json:"latest_commit,omitempty"`
+	Commits      []Commit `json:"commits"`
+}
+
+// Commit holds the findings of one commit, the hash is empty for the findings
+// outside of the git history
+type Commit struct {
+	Hash string `json:"hash"`
+	// Refs are the refs the commit is reachable from when it's scanned
+	Refs       []string    `json:"refs,omitempty"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// Signature holds the findings of one signature in a commit
+type Signature struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Findings    []Finding `json:"findings"`
+}
+
+// Finding is a single match of a signature
+type Finding struct {
+	Filename string `json:"filename"`
+	// LineNumber is one based in every report format, the database line_num
+	// is zero based
+	LineNumber     int32      `json:"line_num"`
+	MatchString    string     `json:"match_string"`
+	Entropy        float64    `json:"entropy,omitempty"`
+	URL            string     `json:"url,omitempty"`
+	AuthorName     string     `json:"author_name,omitempty"`
+	AuthorEmail    string     `json:"author_email,omitempty"`
+	CommitterName  string     `json:"committer_name,omitempty"`
+	CommitterEmail string     `json:"committer_email,omitempty"`
+	CommitTime     *time.Time `json:"commit_time,omitempty"`
+	// PresentAtHead is nil when the status is unknown, e.g. a commit message
+	PresentAtHead *bool     `json:"present_at_head,omitempty"`
+	RemovedIn     string    `json:"removed_in,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// IsPresentAtHead return true if the finding is known to be present at HEAD
+func (f Finding) IsPresentAtHead() bool {
+	return f.PresentAtHead != nil && *f.PresentAtHead
+}
+
+// IsRemoved return true if the finding is known to be removed from HEAD
+func (f Finding) IsRemoved() bool {
+	return f.PresentAtHead != nil && !*f.PresentAtHead
+}
+
+// FormatFromFileName return the report file type from the output file name
+// extension
+func FormatFromFileName(fileName string) (string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return JSON, nil
+	case ".html", ".htm":
+		return HTML, nil
+	case ".sarif":
+		return SARIF, nil
+	}
+
+	return "", ErrInvalidFormat
+}
+
+// Build reads the analysis and findings table and groups them into a Report,
+// sigs is optional and only used for describing the signatures
+func Build(ctx context.Context, db database.Service,
+	sigs []signature.Base) (*Report, error) {
+	repos, err := db.GetRepos(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := db.GetFindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	analyzed := make(map[string]git.Repository, len(repos))
+	for _, repo := range repos {
+		analyzed[repo.Name] = repo
+	}
+
+	r := &Report{
+		GeneratedAt:  time.Now(),
+		Total:        len(findings),
+		Repositories: make([]Repository, 0),
+		Signatures:   sigs,
+	}
+
+	// findings are already ordered by repository, commit and signature, so
+	// only the last group needs to be checked
+	for _, f := range findings {
+		n := len(r.Repositories)
+		if n == 0 || r.Repositories[n-1].Name != f.RepoName {
+			r.Repositories = append(r.Repositories, Repository{
+				Name:         f.RepoName,
+				Kind:         analyzed[f.RepoName].Kind,
+				LatestCommit: analyzed[f.RepoName].LatestCommit,
+			})
+			n++
+		}
+		repo := &r.Repositories[n-1]
+
+		n = len(repo.Commits)
+		if n == 0 || repo.Commits[n-1].Hash != f.CommitHash {
+			repo.Commits = append(repo.Commits, Commit{
+				Hash: f.CommitHash,
+				Refs: f.Refs,
+			})
+			n++
+		}
+		commit := &repo.Commits[n-1]
+
+		n = len(commit.Signatures)
+		if n == 0 || commit.Signatures[n-1].ID != f.SignatureID {
+			commit.Signatures = append(commit.Signatures, Signature{
+				ID:          f.SignatureID,
+				Description: f.Description,
+			})
+			n++
+		}
+		sig := &commit.Signatures[n-1]
+
+		finding := Finding{
+			Filename:       f.Filename,
+			LineNumber:     f.LineNumber + 1,
+			MatchString:    f.MatchString,
+			Entropy:        f.Entropy,
+			URL:            f.URL,
+			AuthorName:     f.AuthorName,
+			AuthorEmail:    f.AuthorEmail,
+			CommitterName:  f.CommitterName,
+			CommitterEmail: f.CommitterEmail,
+			PresentAtHead:  f.PresentAtHead,
+			RemovedIn:      f.RemovedIn,
+			CreatedAt:      f.CreatedAt,
+		}
+		// findings outside of the git history don't have a commit time
+		if !f.CommitTime.IsZero() {
+			commitTime := f.CommitTime
+			finding.CommitTime = &commitTime
+		}
+
+		if finding.IsPresentAtHead() {
+			r.PresentAtHead++
+		}
+
+		sig.Findings = append(sig.Findings, finding)
+	}
+
+	return r, nil
+}
+
+// Write renders the report to w with the given file type
+func Write(w io.Writer, format string, r *Report) error {
+	switch format {
+	case JSON:
+		return writeJSON(w, r)
+	case HTML:
+		return writeHTML(w, r)
+	case SARIF:
+		return writeSARIF(w, r)
+	}
+
+	return ErrInvalidFormat
+}
+
+// Generate builds the report from database and writes it to fileName
+func Generate(ctx context.Context, db database.Service, sigs []signature.Base,
+	fileName, format string) error {
+	r, err := Build(ctx, db, sigs)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err = Write(f, format, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
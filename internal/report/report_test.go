@@ -0,0 +1,251 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circleous/gitseer/internal/database"
+	"github.com/circleous/gitseer/internal/report"
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+type stubDatabase struct {
+	database.Service
+
+	repos    []git.Repository
+	findings []database.Finding
+}
+
+func (db *stubDatabase) GetRepos(context.Context) ([]git.Repository, error) {
+	return db.repos, nil
+}
+
+func (db *stubDatabase) GetFindings(context.Context) ([]database.Finding, error) {
+	return db.findings, nil
+}
+
+func newStubDatabase() *stubDatabase {
+	present, removed := true, false
+
+	return &stubDatabase{
+		repos: []git.Repository{
+			{Name: "circleous/a", LatestCommit: "c2"},
+			{Name: "circleous/b", LatestCommit: "c3"},
+		},
+		findings: []database.Finding{
+			{RepoName: "circleous/a", CommitHash: "c1", SignatureID: "s1",
+				Filename: "id_rsa", Description: "Private SSH key",
+				AuthorName: "alice", AuthorEmail: "alice@example.com",
+				CommitterName: "bob", CommitterEmail: "bob@example.com",
+				CommitTime: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)},
+			{RepoName: "circleous/a", CommitHash: "c1", SignatureID: "s2",
+				Filename: "a.env", MatchString: "password=<script>",
+				Description: "Looks like a password", LineNumber: 3},
+			{RepoName: "circleous/a", CommitHash: "c1", SignatureID: "s2",
+				Filename: "b.env", MatchString: "password=hunter2",
+				Description: "Looks like a password", PresentAtHead: &present},
+			{RepoName: "circleous/a", CommitHash: "c2", SignatureID: "s2",
+				Filename: "a.env", MatchString: "password=hunter3",
+				Description: "Looks like a password", PresentAtHead: &removed,
+				RemovedIn: "c3"},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	r, err := report.Build(context.Background(), newStubDatabase(), nil)
+	if err != nil {
+		t.Fatalf("failed to build report, %v", err)
+	}
+
+	if r.Total != 4 {
+		t.Errorf("expected 4 findings, got %d", r.Total)
+	}
+
+	if r.PresentAtHead != 1 {
+		t.Errorf("expected 1 finding present at HEAD, got %d",
+			r.PresentAtHead)
+	}
+
+	if len(r.Repositories) != 1 {
+		t.Fatalf("expected 1 repository, got %d", len(r.Repositories))
+	}
+
+	repo := r.Repositories[0]
+	if repo.LatestCommit != "c2" {
+		t.Errorf("expected latest commit c2, got %s", repo.LatestCommit)
+	}
+
+	if len(repo.Commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(repo.Commits))
+	}
+
+	if len(repo.Commits[0].Signatures) != 2 {
+		t.Fatalf("expected 2 signatures, got %d",
+			len(repo.Commits[0].Signatures))
+	}
+
+	if n := len(repo.Commits[0].Signatures[1].Findings); n != 2 {
+		t.Errorf("expected 2 findings for signature s2, got %d", n)
+	}
+
+	f := repo.Commits[0].Signatures[0].Findings[0]
+	if f.AuthorEmail != "alice@example.com" ||
+		f.CommitterName != "bob" || f.CommitTime == nil ||
+		f.CommitTime.Year() != 2021 {
+		t.Errorf("unexpected commit metadata %+v", f)
+	}
+
+	// findings without commit metadata omit the commit time
+	if f = repo.Commits[0].Signatures[1].Findings[0]; f.CommitTime != nil {
+		t.Errorf("expected no commit time, got %v", f.CommitTime)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r, err := report.Build(context.Background(), newStubDatabase(), nil)
+	if err != nil {
+		t.Fatalf("failed to build report, %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.Write(&buf, report.JSON, r); err != nil {
+		t.Fatalf("failed to write json report, %v", err)
+	}
+
+	var decoded report.Report
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json report, %v", err)
+	}
+
+	if decoded.Total != r.Total {
+		t.Errorf("expected %d findings, got %d", r.Total, decoded.Total)
+	}
+
+	// line numbers are one based in every report format
+	f := decoded.Repositories[0].Commits[0].Signatures[1].Findings[0]
+	if f.Filename != "a.env" || f.LineNumber != 4 {
+		t.Errorf("unexpected json finding %+v", f)
+	}
+
+	buf.Reset()
+	if err = report.Write(&buf, report.HTML, r); err != nil {
+		t.Fatalf("failed to write html report, %v", err)
+	}
+
+	if strings.Contains(buf.String(), "<script>") {
+		t.Error("match string is not escaped in html report")
+	}
+
+	if !strings.Contains(buf.String(), "<td>4</td>") {
+		t.Error("line number is not one based in html report")
+	}
+
+	if err = report.Write(&buf, "pdf", r); err != report.ErrInvalidFormat {
+		t.Errorf("expected ErrInvalidFormat, got %v", err)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	sigs := []signature.Base{
+		{ID: "s1", Description: "Private SSH key", Enable: true},
+		{ID: "s3", Description: "Disabled", Enable: false},
+	}
+
+	db := newStubDatabase()
+	db.findings = append(db.findings, database.Finding{
+		RepoName: "circleous/a", CommitHash: "c2", SignatureID: "s2",
+		Filename: ":commit-message", MatchString: "password=hunter4",
+		Description: "Looks like a password"})
+
+	r, err := report.Build(context.Background(), db, sigs)
+	if err != nil {
+		t.Fatalf("failed to build report, %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.Write(&buf, report.SARIF, r); err != nil {
+		t.Fatalf("failed to write sarif report, %v", err)
+	}
+
+	var decoded struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation *struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+					LogicalLocations []struct {
+						FullyQualifiedName string `json:"fullyQualifiedName"`
+					} `json:"logicalLocations"`
+				} `json:"locations"`
+				PartialFingerprints map[string]string `json:"partialFingerprints"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid sarif report, %v", err)
+	}
+
+	if decoded.Version != "2.1.0" || len(decoded.Runs) != 1 {
+		t.Fatalf("unexpected sarif log %s", buf.String())
+	}
+
+	run := decoded.Runs[0]
+	if n := len(run.Tool.Driver.Rules); n != 2 {
+		t.Errorf("expected 2 rules (s1 and s2), got %d", n)
+	}
+
+	if n := len(run.Results); n != 5 {
+		t.Fatalf("expected 5 results, got %d", n)
+	}
+
+	loc := run.Results[1].Locations[0].PhysicalLocation
+	if loc == nil || loc.ArtifactLocation.URI != "a.env" ||
+		loc.Region.StartLine != 4 {
+		t.Errorf("unexpected location %+v", loc)
+	}
+
+	// the commit message isn't a file
+	msg := run.Results[4].Locations[0]
+	if msg.PhysicalLocation != nil || len(msg.LogicalLocations) != 1 ||
+		msg.LogicalLocations[0].FullyQualifiedName != ":commit-message" {
+		t.Errorf("unexpected commit message location %+v", msg)
+	}
+
+	// every result of the same commit is a separate alert
+	seen := make(map[string]bool)
+	for _, result := range run.Results {
+		fingerprint := result.PartialFingerprints["gitseerFinding/v1"]
+		if fingerprint == "" || seen[fingerprint] {
+			t.Errorf("duplicate fingerprint %q", fingerprint)
+		}
+		seen[fingerprint] = true
+	}
+
+	// the secret removed from HEAD is only a warning
+	if run.Results[2].Level != "error" || run.Results[3].Level != "warning" {
+		t.Errorf("unexpected levels %s and %s", run.Results[2].Level,
+			run.Results[3].Level)
+	}
+}
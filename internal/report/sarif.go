@@ -0,0 +1,223 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          sarifProperties   `json:"properties"`
+}
+
+// sarifLocation is either a file in the repository or a logical location for
+// the findings outside of the files, e.g. a commit message or a comment
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int32 `json:"startLine"`
+}
+
+type sarifProperties struct {
+	Repository string   `json:"repository"`
+	Kind       string   `json:"kind,omitempty"`
+	Commit     string   `json:"commit"`
+	Refs       []string `json:"refs,omitempty"`
+	URL        string   `json:"url,omitempty"`
+
+	AuthorName     string     `json:"authorName,omitempty"`
+	AuthorEmail    string     `json:"authorEmail,omitempty"`
+	CommitterName  string     `json:"committerName,omitempty"`
+	CommitterEmail string     `json:"committerEmail,omitempty"`
+	CommitTime     *time.Time `json:"commitTime,omitempty"`
+
+	PresentAtHead *bool  `json:"presentAtHead,omitempty"`
+	RemovedIn     string `json:"removedIn,omitempty"`
+}
+
+func writeSARIF(w io.Writer, r *Report) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           "gitseer",
+				InformationURI: "https://github.com/circleous/gitseer",
+				Rules:          make([]sarifRule, 0),
+			},
+		},
+		Results: make([]sarifResult, 0),
+	}
+
+	ruleIndex := make(map[string]int)
+	addRule := func(id, description string) int {
+		if idx, ok := ruleIndex[id]; ok {
+			return idx
+		}
+
+		ruleIndex[id] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               id,
+			ShortDescription: sarifMessage{Text: description},
+		})
+
+		return ruleIndex[id]
+	}
+
+	for _, sig := range r.Signatures {
+		if !sig.Enable {
+			continue
+		}
+		addRule(sig.ID, sig.Description)
+	}
+
+	for _, repo := range r.Repositories {
+		for _, commit := range repo.Commits {
+			for _, sig := range commit.Signatures {
+				// signatures could be removed from the signature file after
+				// the scan, fallback to the stored description
+				idx := addRule(sig.ID, sig.Description)
+
+				for _, f := range sig.Findings {
+					// secrets removed from HEAD are only in the history
+					level := "error"
+					if f.IsRemoved() {
+						level = "warning"
+					}
+
+					run.Results = append(run.Results, sarifResult{
+						RuleID:    sig.ID,
+						RuleIndex: idx,
+						Level:     level,
+						Message:   sarifMessage{Text: sig.Description},
+						Locations: []sarifLocation{newSARIFLocation(f)},
+						PartialFingerprints: map[string]string{
+							"gitseerFinding/v1": sarifFingerprint(repo.Name,
+								commit.Hash, sig.ID, f),
+						},
+						Properties: sarifProperties{
+							Repository: repo.Name,
+							Kind:       repo.Kind,
+							Commit:     commit.Hash,
+							Refs:       commit.Refs,
+							URL:        f.URL,
+
+							AuthorName:     f.AuthorName,
+							AuthorEmail:    f.AuthorEmail,
+							CommitterName:  f.CommitterName,
+							CommitterEmail: f.CommitterEmail,
+							CommitTime:     f.CommitTime,
+
+							PresentAtHead: f.PresentAtHead,
+							RemovedIn:     f.RemovedIn,
+						},
+					})
+				}
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// newSARIFLocation return the location of the finding, the file path is
+// percent-encoded as a relative URI. The commit and tag messages and the
+// comments are not files, they're logical locations
+func newSARIFLocation(f Finding) sarifLocation {
+	if f.URL != "" || strings.HasPrefix(f.Filename, ":") {
+		return sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{
+				FullyQualifiedName: f.Filename,
+			}},
+		}
+	}
+
+	return sarifLocation{
+		PhysicalLocation: &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{
+				URI: (&url.URL{Path: f.Filename}).String(),
+			},
+			Region: sarifRegion{StartLine: f.LineNumber},
+		},
+	}
+}
+
+// sarifFingerprint return the fingerprint of a single finding, code scanning
+// merges the results with the same fingerprint into one alert
+func sarifFingerprint(repoName, commitHash, signatureID string,
+	f Finding) string {
+	h := sha256.New()
+	for _, field := range []string{repoName, commitHash, signatureID,
+		f.Filename, strconv.Itoa(int(f.LineNumber)), f.MatchString} {
+		// the fields are length prefixed so they can't run into each other
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,15 @@
+package git
+
+// Comment is a text content of a repository outside of its git history, e.g.
+// an issue body or a pull request review comment
+type Comment struct {
+	// Path is the synthetic path of the comment, e.g. issues/123#comment-456
+	Path string
+	// URL links back to the comment
+	URL string
+	// CommitHash is the commented commit of a commit comment, empty for the
+	// others
+	CommitHash string
+	// Body is the comment content
+	Body string
+}
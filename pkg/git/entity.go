@@ -5,6 +5,12 @@ const (
 	GITHUB = "github"
 	// GITLAB service type
 	GITLAB = "gitlab"
+	// GITEA service type, also used for forgejo
+	GITEA = "gitea"
+	// BITBUCKET service type, bitbucket cloud (bitbucket.org)
+	BITBUCKET = "bitbucket"
+	// BITBUCKETSERVER service type, self-hosted bitbucket server / data center
+	BITBUCKETSERVER = "bitbucket_server"
 )
 
 // DefaultListRepositoriesOpt is the default option for list repository
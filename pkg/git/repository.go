@@ -1,11 +1,123 @@
 package git
 
+import "strings"
+
+const (
+	// KindRepository is a regular repository, the zero value of
+	// Repository.Kind
+	KindRepository = ""
+	// KindGist is a github gist, the name is in owner/gist-id format
+	KindGist = "gist"
+	// KindWiki is the wiki of a repository, the name is the repository name
+	// with .wiki suffix
+	KindWiki = "wiki"
+	// KindDirectory is a plain directory scanned without git, the name is the
+	// directory path
+	KindDirectory = "directory"
+)
+
 // Repository is the struct containing the repo data from user/org
 type Repository struct {
 	// Name repository name in user/example-git-repo format
 	Name string
 	// URL git clone-able repo URL
 	URL string
+	// SSHURL git clone-able repo URL over SSH, used when cloning with an SSH
+	// key or agent
+	SSHURL string
+	// Path is the path of an existing local repository, it's opened instead
+	// of cloned, or the path of a KindDirectory
+	Path string
+	// Host is the git service host of the repository, e.g. github.com, the
+	// same name on different hosts are different repositories
+	Host string
+	// Service is the git service type or name the repository is listed from
+	Service string
+	// Kind is the kind of the repository, see KindRepository, KindGist,
+	// KindWiki and KindDirectory
+	Kind string
+	// HasWiki is true when the service reports the wiki is enabled, the wiki
+	// is a separate repository, see Wiki
+	HasWiki bool
+	// Credential is used for cloning the repository, nil for anonymous clone
+	Credential Credential
+	// Upstream is the repository this repository is forked from, nil if it's
+	// not a fork or the service doesn't report it
+	Upstream *Repository
 	// LatestCommit latest commit hash of the repo
 	LatestCommit string
+	// Refs latest scanned commit hash of each ref, only tracked when more than
+	// HEAD is scanned
+	Refs map[string]string
+}
+
+// FullName return the repository name prefixed with its host, e.g.
+// github.com/user/example-git-repo, or only the name if the host is unknown
+func (r Repository) FullName() string {
+	if r.Host == "" {
+		return r.Name
+	}
+
+	return r.Host + "/" + r.Name
+}
+
+// Wiki return the wiki repository of r, <repo>.wiki.git is the wiki clone URL
+// of github, gitlab and gitea
+func (r Repository) Wiki() Repository {
+	wikiURL := func(u string) string {
+		if u == "" {
+			return ""
+		}
+		return strings.TrimSuffix(u, ".git") + ".wiki.git"
+	}
+
+	return Repository{
+		Name:       r.Name + ".wiki",
+		URL:        wikiURL(r.URL),
+		SSHURL:     wikiURL(r.SSHURL),
+		Host:       r.Host,
+		Service:    r.Service,
+		Kind:       KindWiki,
+		Credential: r.Credential,
+	}
+}
+
+// ScannedCommits return the unique latest scanned commit hashes of HEAD and
+// the refs
+func (r Repository) ScannedCommits() []string {
+	var hashes []string
+
+	seen := map[string]bool{"": true}
+	if !seen[r.LatestCommit] {
+		seen[r.LatestCommit] = true
+		hashes = append(hashes, r.LatestCommit)
+	}
+
+	for _, hash := range r.Refs {
+		if !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return hashes
+}
+
+// Credential provides the HTTP basic auth credential for cloning a repository
+type Credential interface {
+	// BasicAuth return the username and password, short-lived credentials are
+	// refreshed when they're expired
+	BasicAuth() (username, password string, err error)
+}
+
+// BasicAuthCredential is a static HTTP basic auth credential, e.g. a personal
+// access token as the password
+type BasicAuthCredential struct {
+	Username string
+	Password string
+}
+
+// BasicAuth return the static username and password
+func (c *BasicAuthCredential) BasicAuth() (string, string, error) {
+	return c.Username, c.Password, nil
 }
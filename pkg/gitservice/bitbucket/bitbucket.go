@@ -0,0 +1,163 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+var (
+	// ErrNotSupported errors for API not provided by the bitbucket flavor
+	ErrNotSupported = errors.New("bitbucket: not supported")
+)
+
+// Service exported interface for bitbucket service, organizations are
+// workspaces (cloud) or projects (server)
+type Service interface {
+	// ListOrgUsers return all users of the workspace / project
+	ListOrgUsers(ctx context.Context, org string) ([]git.User, error)
+	// ListOrgRepositories return all repositories in the workspace / project
+	// revive:disable-next-line:line-length-limit
+	ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+	// ListUserRepositories return all repositories owned by a user
+	// revive:disable-next-line:line-length-limit
+	ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+
+	FindUserFuzzy(ctx context.Context, query string) ([]git.User, error)
+}
+
+// ErrorResponse is returned when the API response status is not 2xx
+type ErrorResponse struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("bitbucket: %d %s", e.StatusCode, e.Message)
+}
+
+// client is a minimal JSON client shared by both bitbucket flavors
+type client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	username   string
+	token      string
+}
+
+// cloneLink is the clone link of a repository in both flavors
+type cloneLink struct {
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+func newClient(baseURL, apiPath, username, token string) (*client, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("bitbucket: invalid base url %q", baseURL)
+	}
+
+	return &client{
+		httpClient: &http.Client{},
+		baseURL:    u.ResolveReference(&url.URL{Path: apiPath}),
+		username:   username,
+		token:      token,
+	}, nil
+}
+
+// get requests the escaped path with query and decodes the JSON response into
+// v. With username, token is used as app password for basic auth, else it's
+// used as bearer access token
+func (c *client) get(ctx context.Context, path string, query url.Values,
+	v interface{}) error {
+	u, err := url.Parse(c.baseURL.String() + path)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.token)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// cloud returns {"error":{"message"}}, server returns
+		// {"errors":[{"message"}]}
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		msg := body.Error.Message
+		if len(body.Errors) > 0 {
+			msg = body.Errors[0].Message
+		}
+
+		return &ErrorResponse{StatusCode: resp.StatusCode, Message: msg}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpCloneURL return the http(s) clone link without the user info, the cloud
+// API adds the requesting username to the link
+func httpCloneURL(links []cloneLink) string {
+	for _, link := range links {
+		if link.Name != "https" && link.Name != "http" {
+			continue
+		}
+
+		u, err := url.Parse(link.Href)
+		if err != nil {
+			return link.Href
+		}
+		u.User = nil
+
+		return u.String()
+	}
+
+	return ""
+}
+
+// sshCloneURL return the ssh clone link
+func sshCloneURL(links []cloneLink) string {
+	for _, link := range links {
+		if link.Name == "ssh" {
+			return link.Href
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,468 @@
+package bitbucket_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice/bitbucket"
+)
+
+const (
+	testUsername = "scanner"
+	testToken    = "app-password"
+)
+
+func authorized(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	return ok && username == testUsername && password == testToken
+}
+
+func cloudRepo(fullName string, fork bool) map[string]interface{} {
+	repo := map[string]interface{}{
+		"full_name": fullName,
+		"links": map[string]interface{}{
+			"clone": []map[string]interface{}{
+				{"name": "https", "href": "https://scanner@bitbucket.org/" + fullName + ".git"},
+				{"name": "ssh", "href": "git@bitbucket.org:" + fullName + ".git"},
+			},
+		},
+	}
+	if fork {
+		repo["parent"] = map[string]interface{}{"full_name": "upstream/" + fullName}
+	}
+	return repo
+}
+
+// newCloudTestServer emulates the bitbucket cloud API 2.0 under /cloud, the
+// members endpoint doesn't include the size to test following next links
+func newCloudTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	paginate := func(w http.ResponseWriter, r *http.Request,
+		pages [][]map[string]interface{}, withSize bool) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"type":"error","error":{"message":"Unauthorized"}}`)
+			return
+		}
+
+		if r.URL.Query().Get("pagelen") != "100" {
+			t.Errorf("expected pagelen=100, got %s", r.URL.RawQuery)
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(pages) {
+			t.Errorf("unexpected page %d", page)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body := map[string]interface{}{
+			"page":    page,
+			"pagelen": 2,
+			"values":  pages[page-1],
+		}
+		if withSize {
+			size := 0
+			for _, p := range pages {
+				size += len(p)
+			}
+			body["size"] = size
+		}
+		if page < len(pages) {
+			body["next"] = fmt.Sprintf("http://%s%s?page=%d", r.Host,
+				r.URL.Path, page+1)
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+
+	mux.HandleFunc("/cloud/2.0/workspaces/acme/members",
+		func(w http.ResponseWriter, r *http.Request) {
+			member := func(uuid string) map[string]interface{} {
+				return map[string]interface{}{
+					"user": map[string]interface{}{"uuid": uuid},
+				}
+			}
+
+			paginate(w, r, [][]map[string]interface{}{
+				{member("{alice}"), member("{bob}")},
+				{member("{carol}")},
+			}, false)
+		})
+
+	mux.HandleFunc("/cloud/2.0/repositories/acme",
+		func(w http.ResponseWriter, r *http.Request) {
+			if q := r.URL.Query().Get("q"); q != "" {
+				if q != `project.key="WEB"` {
+					t.Errorf("unexpected project query %s", q)
+				}
+
+				paginate(w, r, [][]map[string]interface{}{
+					{cloudRepo("acme/web", false)},
+				}, true)
+				return
+			}
+
+			paginate(w, r, [][]map[string]interface{}{
+				{cloudRepo("acme/api", false), cloudRepo("acme/web", false)},
+				{cloudRepo("acme/fork", true)},
+			}, true)
+		})
+
+	mux.HandleFunc("/cloud/2.0/repositories/{alice}",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, [][]map[string]interface{}{
+				{cloudRepo("alice/dotfiles", false)},
+			}, true)
+		})
+
+	return httptest.NewServer(mux)
+}
+
+func serverRepo(project, slug string, fork bool) map[string]interface{} {
+	repo := map[string]interface{}{
+		"slug":    slug,
+		"project": map[string]interface{}{"key": project},
+		"links": map[string]interface{}{
+			"clone": []map[string]interface{}{
+				{"name": "ssh", "href": "ssh://git@bitbucket.example.com:7999/" + project + "/" + slug + ".git"},
+				{"name": "http", "href": "https://scanner@bitbucket.example.com/scm/" + project + "/" + slug + ".git"},
+			},
+		},
+	}
+	if fork {
+		repo["origin"] = map[string]interface{}{"slug": slug}
+	}
+	return repo
+}
+
+// newServerTestServer emulates the bitbucket server REST API 1.0 under
+// /server, every endpoint returns one item per page
+func newServerTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	paginate := func(w http.ResponseWriter, r *http.Request,
+		items []map[string]interface{}) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors":[{"message":"Authentication failed"}]}`)
+			return
+		}
+
+		if r.URL.Query().Get("limit") != "100" {
+			t.Errorf("expected limit=100, got %s", r.URL.RawQuery)
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		if start < 0 || start >= len(items) && len(items) > 0 {
+			t.Errorf("unexpected start %d", start)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		end := start + 1
+		if end > len(items) {
+			end = len(items)
+		}
+
+		body := map[string]interface{}{
+			"start":      start,
+			"size":       end - start,
+			"isLastPage": end == len(items),
+			"values":     items[start:end],
+		}
+		if end < len(items) {
+			body["nextPageStart"] = end
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+
+	mux.HandleFunc("/server/rest/api/1.0/projects/INFRA/permissions/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			permission := func(slug string) map[string]interface{} {
+				return map[string]interface{}{
+					"user":       map[string]interface{}{"slug": slug},
+					"permission": "PROJECT_READ",
+				}
+			}
+
+			paginate(w, r, []map[string]interface{}{
+				permission("alice"), permission("bob"),
+			})
+		})
+
+	mux.HandleFunc("/server/rest/api/1.0/projects/INFRA/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, []map[string]interface{}{
+				serverRepo("INFRA", "ansible", false),
+				serverRepo("INFRA", "terraform", false),
+				serverRepo("INFRA", "upstream", true),
+			})
+		})
+
+	mux.HandleFunc("/server/rest/api/1.0/projects/~alice/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, []map[string]interface{}{
+				serverRepo("~ALICE", "notes", false),
+			})
+		})
+
+	mux.HandleFunc("/server/rest/api/1.0/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("filter") != "ali" {
+				t.Errorf("expected filter=ali, got %s", r.URL.RawQuery)
+			}
+
+			paginate(w, r, []map[string]interface{}{
+				{"slug": "alice"}, {"slug": "alina"},
+			})
+		})
+
+	return httptest.NewServer(mux)
+}
+
+func newCloudTestService(t *testing.T, srv *httptest.Server, token string) bitbucket.Service {
+	ctx := context.WithValue(context.Background(), git.MaxWorkerKey, 2)
+	bcs, err := bitbucket.NewBitbucketCloudClient(ctx, srv.URL+"/cloud",
+		testUsername, token)
+	if err != nil {
+		t.Fatalf("failed to create bitbucket cloud client, %v", err)
+	}
+	return bcs
+}
+
+func newServerTestService(t *testing.T, srv *httptest.Server, token string) bitbucket.Service {
+	bss, err := bitbucket.NewBitbucketServerClient(context.Background(),
+		srv.URL+"/server", testUsername, token)
+	if err != nil {
+		t.Fatalf("failed to create bitbucket server client, %v", err)
+	}
+	return bss
+}
+
+func repoNames(repos []git.Repository) []string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func userNames(users []git.User, serviceType string) []string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		if user.Type != serviceType {
+			names = append(names, "invalid type "+user.Type)
+		}
+		names = append(names, user.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCloudListOrgUsers(t *testing.T) {
+	srv := newCloudTestServer(t)
+	defer srv.Close()
+
+	users, err := newCloudTestService(t, srv, testToken).
+		ListOrgUsers(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("failed to list workspace members, %v", err)
+	}
+
+	got := fmt.Sprint(userNames(users, git.BITBUCKET))
+	if got != "[{alice} {bob} {carol}]" {
+		t.Errorf("unexpected workspace members %s", got)
+	}
+}
+
+func TestCloudListOrgRepositories(t *testing.T) {
+	srv := newCloudTestServer(t)
+	defer srv.Close()
+
+	bcs := newCloudTestService(t, srv, testToken)
+
+	repos, err := bcs.ListOrgRepositories(context.Background(), "acme", nil)
+	if err != nil {
+		t.Fatalf("failed to list workspace repositories, %v", err)
+	}
+
+	if got := fmt.Sprint(repoNames(repos)); got != "[acme/api acme/web]" {
+		t.Errorf("unexpected workspace repositories %s", got)
+	}
+
+	for _, repo := range repos {
+		want := "https://bitbucket.org/" + repo.Name + ".git"
+		if repo.URL != want {
+			t.Errorf("expected clone url %s, got %s", want, repo.URL)
+		}
+	}
+
+	repos, err = bcs.ListOrgRepositories(context.Background(), "acme",
+		&git.ListRepositoriesOptions{WithFork: true})
+	if err != nil {
+		t.Fatalf("failed to list workspace repositories, %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Errorf("expected 3 repositories with fork, got %d", len(repos))
+	}
+
+	repos, err = bcs.ListOrgRepositories(context.Background(), "acme/WEB", nil)
+	if err != nil {
+		t.Fatalf("failed to list project repositories, %v", err)
+	}
+
+	if got := fmt.Sprint(repoNames(repos)); got != "[acme/web]" {
+		t.Errorf("unexpected project repositories %s", got)
+	}
+}
+
+func TestCloudListUserRepositories(t *testing.T) {
+	srv := newCloudTestServer(t)
+	defer srv.Close()
+
+	repos, err := newCloudTestService(t, srv, testToken).
+		ListUserRepositories(context.Background(), "{alice}", nil)
+	if err != nil {
+		t.Fatalf("failed to list user repositories, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].Name != "alice/dotfiles" ||
+		repos[0].URL != "https://bitbucket.org/alice/dotfiles.git" {
+		t.Errorf("unexpected user repositories %v", repos)
+	}
+}
+
+func TestCloudFindUserFuzzy(t *testing.T) {
+	srv := newCloudTestServer(t)
+	defer srv.Close()
+
+	_, err := newCloudTestService(t, srv, testToken).
+		FindUserFuzzy(context.Background(), "ali")
+	if err != bitbucket.ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestCloudUnauthorized(t *testing.T) {
+	srv := newCloudTestServer(t)
+	defer srv.Close()
+
+	_, err := newCloudTestService(t, srv, "invalid").
+		ListOrgUsers(context.Background(), "acme")
+
+	errResp, ok := err.(*bitbucket.ErrorResponse)
+	if !ok || errResp.StatusCode != http.StatusUnauthorized ||
+		errResp.Message != "Unauthorized" {
+		t.Errorf("expected 401 error response, got %v", err)
+	}
+}
+
+func TestServerListOrgUsers(t *testing.T) {
+	srv := newServerTestServer(t)
+	defer srv.Close()
+
+	users, err := newServerTestService(t, srv, testToken).
+		ListOrgUsers(context.Background(), "INFRA")
+	if err != nil {
+		t.Fatalf("failed to list project users, %v", err)
+	}
+
+	got := fmt.Sprint(userNames(users, git.BITBUCKETSERVER))
+	if got != "[alice bob]" {
+		t.Errorf("unexpected project users %s", got)
+	}
+}
+
+func TestServerListOrgRepositories(t *testing.T) {
+	srv := newServerTestServer(t)
+	defer srv.Close()
+
+	bss := newServerTestService(t, srv, testToken)
+
+	repos, err := bss.ListOrgRepositories(context.Background(), "INFRA", nil)
+	if err != nil {
+		t.Fatalf("failed to list project repositories, %v", err)
+	}
+
+	got := fmt.Sprint(repoNames(repos))
+	if got != "[INFRA/ansible INFRA/terraform]" {
+		t.Errorf("unexpected project repositories %s", got)
+	}
+
+	if repos[0].URL != "https://bitbucket.example.com/scm/INFRA/ansible.git" {
+		t.Errorf("unexpected clone url %s", repos[0].URL)
+	}
+
+	repos, err = bss.ListOrgRepositories(context.Background(), "INFRA",
+		&git.ListRepositoriesOptions{WithFork: true})
+	if err != nil {
+		t.Fatalf("failed to list project repositories, %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Errorf("expected 3 repositories with fork, got %d", len(repos))
+	}
+}
+
+func TestServerListUserRepositories(t *testing.T) {
+	srv := newServerTestServer(t)
+	defer srv.Close()
+
+	repos, err := newServerTestService(t, srv, testToken).
+		ListUserRepositories(context.Background(), "alice", nil)
+	if err != nil {
+		t.Fatalf("failed to list user repositories, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].Name != "~ALICE/notes" {
+		t.Errorf("unexpected user repositories %v", repos)
+	}
+}
+
+func TestServerFindUserFuzzy(t *testing.T) {
+	srv := newServerTestServer(t)
+	defer srv.Close()
+
+	users, err := newServerTestService(t, srv, testToken).
+		FindUserFuzzy(context.Background(), "ali")
+	if err != nil {
+		t.Fatalf("failed to search users, %v", err)
+	}
+
+	got := fmt.Sprint(userNames(users, git.BITBUCKETSERVER))
+	if got != "[alice alina]" {
+		t.Errorf("unexpected users %s", got)
+	}
+}
+
+func TestServerUnauthorized(t *testing.T) {
+	srv := newServerTestServer(t)
+	defer srv.Close()
+
+	_, err := newServerTestService(t, srv, "invalid").
+		ListOrgUsers(context.Background(), "INFRA")
+
+	errResp, ok := err.(*bitbucket.ErrorResponse)
+	if !ok || errResp.StatusCode != http.StatusUnauthorized ||
+		errResp.Message != "Authentication failed" {
+		t.Errorf("expected 401 error response, got %v", err)
+	}
+}
+
+func TestServerInvalidBaseURL(t *testing.T) {
+	_, err := bitbucket.NewBitbucketServerClient(context.Background(), "",
+		testUsername, testToken)
+	if err == nil {
+		t.Error("expected error for empty base url")
+	}
+}
@@ -0,0 +1,253 @@
+package bitbucket
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+const (
+	// DefaultCloudBaseURL is the bitbucket cloud API base URL
+	DefaultCloudBaseURL = "https://api.bitbucket.org/"
+
+	cloudAPIPath = "2.0/"
+	cloudPageLen = 100
+)
+
+type cloudService struct {
+	client    *client
+	maxWorker int
+}
+
+type cloudPage struct {
+	Size    int    `json:"size"`
+	Page    int    `json:"page"`
+	PageLen int    `json:"pagelen"`
+	Next    string `json:"next"`
+}
+
+type cloudRepositoryPage struct {
+	cloudPage
+	Values []struct {
+		FullName string `json:"full_name"`
+		Parent   *struct {
+			FullName string `json:"full_name"`
+		} `json:"parent"`
+		Links struct {
+			Clone []cloneLink `json:"clone"`
+		} `json:"links"`
+	} `json:"values"`
+}
+
+type cloudMemberPage struct {
+	cloudPage
+	Values []struct {
+		User struct {
+			UUID string `json:"uuid"`
+		} `json:"user"`
+	} `json:"values"`
+}
+
+// NewBitbucketCloudClient create new bitbucket cloud api client, empty baseURL
+// will use api.bitbucket.org. username and token (app password) could be empty
+// for public data only, token without username is used as access token. Users
+// are identified by their account UUID, which is also their personal workspace
+func NewBitbucketCloudClient(ctx context.Context, baseURL, username,
+	token string) (Service, error) {
+	var maxWorker int
+	var ok bool
+
+	if baseURL == "" {
+		baseURL = DefaultCloudBaseURL
+	}
+
+	c, err := newClient(baseURL, cloudAPIPath, username, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxWorker, ok = ctx.Value(git.MaxWorkerKey).(int); !ok {
+		maxWorker = 10 // fallback
+	}
+
+	return &cloudService{
+		client:    c,
+		maxWorker: maxWorker,
+	}, nil
+}
+
+// getAll requests every page of path, newPage is called to allocate the
+// decoded page and collect is called with each decoded page. The first page
+// is requested to get the total size and the rest are requested concurrently
+// with at most maxWorker requests, or by following the next link if the size
+// is not included
+func (bcs *cloudService) getAll(ctx context.Context, path string,
+	query url.Values, newPage func() interface{},
+	collect func(page interface{}) *cloudPage) error {
+	var m sync.Mutex
+
+	if query == nil {
+		query = url.Values{}
+	}
+
+	withPage := func(page int) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("pagelen", strconv.Itoa(cloudPageLen))
+		q.Set("page", strconv.Itoa(page))
+		return q
+	}
+
+	v := newPage()
+	if err := bcs.client.get(ctx, path, withPage(1), v); err != nil {
+		return err
+	}
+	p := collect(v)
+
+	if p.Size == 0 || p.PageLen == 0 {
+		for page := 2; p.Next != ""; page++ {
+			v := newPage()
+			if err := bcs.client.get(ctx, path, withPage(page), v); err != nil {
+				return err
+			}
+			p = collect(v)
+		}
+
+		return nil
+	}
+
+	lastPage := (p.Size + p.PageLen - 1) / p.PageLen
+
+	sem := semaphore.NewWeighted(int64(bcs.maxWorker))
+	errs := make([]error, lastPage+1)
+
+	for page := 2; page <= lastPage; page++ {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+
+		page := page // copy
+		go func() {
+			defer sem.Release(1)
+
+			v := newPage()
+			if err := bcs.client.get(ctx, path, withPage(page), v); err != nil {
+				errs[page] = err
+				return
+			}
+
+			m.Lock()
+			collect(v)
+			m.Unlock()
+		}()
+	}
+
+	// wait
+	if err := sem.Acquire(ctx, int64(bcs.maxWorker)); err != nil {
+		return err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListOrgUsers return all members of the workspace, org could also be
+// workspace/PROJECT_KEY, the members are still listed from the workspace
+// revive:disable-next-line:line-length-limit
+func (bcs *cloudService) ListOrgUsers(ctx context.Context, org string) ([]git.User, error) {
+	var users []git.User
+
+	workspace := strings.SplitN(org, "/", 2)[0]
+
+	err := bcs.getAll(ctx, "workspaces/"+url.PathEscape(workspace)+"/members",
+		nil,
+		func() interface{} { return &cloudMemberPage{} },
+		func(page interface{}) *cloudPage {
+			p := page.(*cloudMemberPage)
+			for _, member := range p.Values {
+				users = append(users, git.User{
+					Name: member.User.UUID,
+					Type: git.BITBUCKET,
+				})
+			}
+			return &p.cloudPage
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListOrgRepositories return all repositories in the workspace, org could also
+// be workspace/PROJECT_KEY to only list the project repositories. When
+// opt.WithFork is true, return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (bcs *cloudService) ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	var query url.Values
+
+	parts := strings.SplitN(org, "/", 2)
+	if len(parts) == 2 {
+		query = url.Values{"q": {`project.key="` + parts[1] + `"`}}
+	}
+
+	return bcs.listRepositories(ctx, parts[0], query, opt)
+}
+
+// ListUserRepositories return all repositories in the user personal
+// workspace, when opt.WithFork is true, return will also includes forked
+// repositories
+// revive:disable-next-line:line-length-limit
+func (bcs *cloudService) ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return bcs.listRepositories(ctx, user, nil, opt)
+}
+
+// revive:disable-next-line:line-length-limit
+func (bcs *cloudService) listRepositories(ctx context.Context, workspace string, query url.Values, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	var repos []git.Repository
+
+	if opt == nil {
+		opt = &git.DefaultListRepositoriesOpt
+	}
+
+	err := bcs.getAll(ctx, "repositories/"+url.PathEscape(workspace), query,
+		func() interface{} { return &cloudRepositoryPage{} },
+		func(page interface{}) *cloudPage {
+			p := page.(*cloudRepositoryPage)
+			for _, repo := range p.Values {
+				if repo.Parent != nil && !opt.WithFork {
+					continue
+				}
+				repos = append(repos, git.Repository{
+					Name:   repo.FullName,
+					URL:    httpCloneURL(repo.Links.Clone),
+					SSHURL: sshCloneURL(repo.Links.Clone),
+				})
+			}
+			return &p.cloudPage
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// FindUserFuzzy is not supported, bitbucket cloud doesn't have user search API
+// revive:disable-next-line:unused-parameter
+func (bcs *cloudService) FindUserFuzzy(ctx context.Context, query string) ([]git.User, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,199 @@
+package bitbucket
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+const (
+	serverAPIPath = "rest/api/1.0/"
+	serverLimit   = 100
+)
+
+type serverService struct {
+	client *client
+}
+
+type serverPage struct {
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+type serverUser struct {
+	Slug string `json:"slug"`
+}
+
+type serverRepositoryPage struct {
+	serverPage
+	Values []struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+		Origin *struct {
+			Slug string `json:"slug"`
+		} `json:"origin"`
+		Links struct {
+			Clone []cloneLink `json:"clone"`
+		} `json:"links"`
+	} `json:"values"`
+}
+
+type serverUserPage struct {
+	serverPage
+	Values []serverUser `json:"values"`
+}
+
+type serverPermissionPage struct {
+	serverPage
+	Values []struct {
+		User serverUser `json:"user"`
+	} `json:"values"`
+}
+
+// NewBitbucketServerClient create new bitbucket server (data center) api
+// client, baseURL is the instance URL, e.g. https://bitbucket.example.com/.
+// With username, token is used as password for basic auth, else it's used as
+// HTTP access token. Organizations are project keys and users are user slugs
+// revive:disable-next-line:unused-parameter
+func NewBitbucketServerClient(ctx context.Context, baseURL, username,
+	token string) (Service, error) {
+	c, err := newClient(baseURL, serverAPIPath, username, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverService{client: c}, nil
+}
+
+// getAll requests every page of path one by one, the server API only returns
+// the start of the next page
+func (bss *serverService) getAll(ctx context.Context, path string,
+	query url.Values, newPage func() interface{},
+	collect func(page interface{}) *serverPage) error {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	for start := 0; ; {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("limit", strconv.Itoa(serverLimit))
+		q.Set("start", strconv.Itoa(start))
+
+		v := newPage()
+		if err := bss.client.get(ctx, path, q, v); err != nil {
+			return err
+		}
+
+		p := collect(v)
+		if p.IsLastPage || p.NextPageStart <= start {
+			return nil
+		}
+		start = p.NextPageStart
+	}
+}
+
+// ListOrgUsers return all users granted an explicit permission to the project
+// revive:disable-next-line:line-length-limit
+func (bss *serverService) ListOrgUsers(ctx context.Context, project string) ([]git.User, error) {
+	var users []git.User
+
+	err := bss.getAll(ctx,
+		"projects/"+url.PathEscape(project)+"/permissions/users", nil,
+		func() interface{} { return &serverPermissionPage{} },
+		func(page interface{}) *serverPage {
+			p := page.(*serverPermissionPage)
+			for _, permission := range p.Values {
+				users = append(users, git.User{
+					Name: permission.User.Slug,
+					Type: git.BITBUCKETSERVER,
+				})
+			}
+			return &p.serverPage
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListOrgRepositories return all repositories in the project, when
+// opt.WithFork is true, return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (bss *serverService) ListOrgRepositories(ctx context.Context, project string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return bss.listRepositories(ctx, project, opt)
+}
+
+// ListUserRepositories return all repositories in the user personal project,
+// when opt.WithFork is true, return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (bss *serverService) ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return bss.listRepositories(ctx, "~"+user, opt)
+}
+
+// revive:disable-next-line:line-length-limit
+func (bss *serverService) listRepositories(ctx context.Context, project string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	var repos []git.Repository
+
+	if opt == nil {
+		opt = &git.DefaultListRepositoriesOpt
+	}
+
+	err := bss.getAll(ctx, "projects/"+url.PathEscape(project)+"/repos", nil,
+		func() interface{} { return &serverRepositoryPage{} },
+		func(page interface{}) *serverPage {
+			p := page.(*serverRepositoryPage)
+			for _, repo := range p.Values {
+				if repo.Origin != nil && !opt.WithFork {
+					continue
+				}
+				repos = append(repos, git.Repository{
+					Name:   repo.Project.Key + "/" + repo.Slug,
+					URL:    httpCloneURL(repo.Links.Clone),
+					SSHURL: sshCloneURL(repo.Links.Clone),
+				})
+			}
+			return &p.serverPage
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// FindUserFuzzy find users with the user filter API, the filter matches
+// username, display name and email
+// revive:disable-next-line:line-length-limit
+func (bss *serverService) FindUserFuzzy(ctx context.Context, query string) ([]git.User, error) {
+	users := make([]git.User, 0)
+
+	err := bss.getAll(ctx, "users", url.Values{"filter": {query}},
+		func() interface{} { return &serverUserPage{} },
+		func(page interface{}) *serverPage {
+			p := page.(*serverUserPage)
+			for _, user := range p.Values {
+				users = append(users, git.User{
+					Name: user.Slug,
+					Type: git.BITBUCKETSERVER,
+				})
+			}
+			return &p.serverPage
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users, nil
+}
@@ -0,0 +1,180 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	apiPath = "api/v1/"
+	// perPage is the default MAX_RESPONSE_ITEMS of gitea
+	perPage = 50
+)
+
+// client is a minimal Gitea REST API v1 client, also compatible with Forgejo
+type client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	token      string
+}
+
+// ErrorResponse is returned when the API response status is not 2xx
+type ErrorResponse struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("gitea: %d %s", e.StatusCode, e.Message)
+}
+
+func newClient(baseURL, token string) (*client, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("gitea: invalid base url %q", baseURL)
+	}
+
+	return &client{
+		httpClient: &http.Client{},
+		baseURL:    u.ResolveReference(&url.URL{Path: apiPath}),
+		token:      token,
+	}, nil
+}
+
+// get requests the escaped path with query and decodes the JSON response into
+// v, it returns the X-Total-Count of the response if it's paginated
+func (c *client) get(ctx context.Context, path string, query url.Values,
+	v interface{}) (int, error) {
+	u, err := url.Parse(c.baseURL.String() + path)
+	if err != nil {
+		return 0, err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		return 0, &ErrorResponse{
+			StatusCode: resp.StatusCode,
+			Message:    body.Message,
+		}
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, err
+	}
+
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+
+	return total, nil
+}
+
+// getAll requests every page of path, newPage is called to allocate the
+// decoded page and collect is called with each decoded page, collect return
+// the number of items in the page. The first page is requested to get the
+// total count and the rest are requested concurrently with at most maxWorker
+// requests
+func (c *client) getAll(ctx context.Context, maxWorker int, path string,
+	query url.Values, newPage func() interface{},
+	collect func(page interface{}) int) error {
+	var m sync.Mutex
+
+	if query == nil {
+		query = url.Values{}
+	}
+
+	withPage := func(page int) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("limit", strconv.Itoa(perPage))
+		q.Set("page", strconv.Itoa(page))
+		return q
+	}
+
+	first := newPage()
+	total, err := c.get(ctx, path, withPage(1), first)
+	if err != nil {
+		return err
+	}
+
+	// the instance could be configured with a lower max response items
+	limit := collect(first)
+	if limit == 0 || limit >= total {
+		return nil
+	}
+	lastPage := (total + limit - 1) / limit
+
+	sem := semaphore.NewWeighted(int64(maxWorker))
+	errs := make([]error, lastPage+1)
+
+	for page := 2; page <= lastPage; page++ {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+
+		page := page // copy
+		go func() {
+			defer sem.Release(1)
+
+			v := newPage()
+			if _, err := c.get(ctx, path, withPage(page), v); err != nil {
+				errs[page] = err
+				return
+			}
+
+			m.Lock()
+			collect(v)
+			m.Unlock()
+		}()
+	}
+
+	// wait
+	if err := sem.Acquire(ctx, int64(maxWorker)); err != nil {
+		return err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
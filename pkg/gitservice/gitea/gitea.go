@@ -0,0 +1,165 @@
+package gitea
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+type giteaService struct {
+	client    *client
+	maxWorker int
+}
+
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+type giteaRepository struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	Fork     bool   `json:"fork"`
+	HasWiki  bool   `json:"has_wiki"`
+}
+
+type giteaUserSearch struct {
+	Data []giteaUser `json:"data"`
+}
+
+// Service exported interface for gitea service
+type Service interface {
+	// ListOrgUsers return all users joined the organization
+	ListOrgUsers(ctx context.Context, org string) ([]git.User, error)
+	// ListOrgRepositories return all repositories in the organization
+	// revive:disable-next-line:line-length-limit
+	ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+	// ListUserRepositories return all repositories owned by a user
+	// revive:disable-next-line:line-length-limit
+	ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+
+	FindUserFuzzy(ctx context.Context, query string) ([]git.User, error)
+}
+
+// NewGiteaClientWithToken create new gitea api client, baseURL is the gitea or
+// forgejo instance URL, e.g. https://gitea.example.com/. token could be empty
+// for public data only. Change max worker in context.Value with
+// gitservice.MaxWorkerKey as key
+func NewGiteaClientWithToken(ctx context.Context, baseURL,
+	token string) (Service, error) {
+	var maxWorker int
+	var ok bool
+
+	c, err := newClient(baseURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxWorker, ok = ctx.Value(git.MaxWorkerKey).(int); !ok {
+		maxWorker = 10 // fallback
+	}
+
+	return &giteaService{
+		client:    c,
+		maxWorker: maxWorker,
+	}, nil
+}
+
+func collectUsers(users *[]git.User) func(page interface{}) int {
+	return func(page interface{}) int {
+		gitUsers := *page.(*[]giteaUser)
+		for _, gitUser := range gitUsers {
+			*users = append(*users, git.User{
+				Name: gitUser.Login,
+				Type: git.GITEA,
+			})
+		}
+		return len(gitUsers)
+	}
+}
+
+// ListOrgUsers return all gitea users joined the organization
+// revive:disable-next-line:line-length-limit
+func (gts *giteaService) ListOrgUsers(ctx context.Context, org string) ([]git.User, error) {
+	var users []git.User
+
+	err := gts.client.getAll(ctx, gts.maxWorker,
+		"orgs/"+url.PathEscape(org)+"/members", nil,
+		func() interface{} { return &[]giteaUser{} },
+		collectUsers(&users))
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListOrgRepositories return all repositories in the organization, when
+// opt.WithFork is true, return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (gts *giteaService) ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return gts.listRepositories(ctx, "orgs/"+url.PathEscape(org)+"/repos", opt)
+}
+
+// ListUserRepositories return all repositories given user, when opt.WithFork
+// is true, return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (gts *giteaService) ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return gts.listRepositories(ctx, "users/"+url.PathEscape(user)+"/repos", opt)
+}
+
+// revive:disable-next-line:line-length-limit
+func (gts *giteaService) listRepositories(ctx context.Context, path string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	var repos []git.Repository
+
+	if opt == nil {
+		opt = &git.DefaultListRepositoriesOpt
+	}
+
+	err := gts.client.getAll(ctx, gts.maxWorker, path, nil,
+		func() interface{} { return &[]giteaRepository{} },
+		func(page interface{}) int {
+			gitRepos := *page.(*[]giteaRepository)
+			for _, gitRepo := range gitRepos {
+				if gitRepo.Fork && !opt.WithFork {
+					continue
+				}
+				repos = append(repos, git.Repository{
+					Name:    gitRepo.FullName,
+					URL:     gitRepo.CloneURL,
+					SSHURL:  gitRepo.SSHURL,
+					HasWiki: gitRepo.HasWiki,
+				})
+			}
+			return len(gitRepos)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// FindUserFuzzy find users with gitea user search API
+// revive:disable-next-line:line-length-limit
+func (gts *giteaService) FindUserFuzzy(ctx context.Context, query string) ([]git.User, error) {
+	users := make([]git.User, 0)
+
+	collect := collectUsers(&users)
+	err := gts.client.getAll(ctx, gts.maxWorker, "users/search",
+		url.Values{"q": {query}},
+		func() interface{} { return &giteaUserSearch{} },
+		func(page interface{}) int {
+			return collect(&page.(*giteaUserSearch).Data)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users, nil
+}
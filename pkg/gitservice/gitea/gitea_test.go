@@ -0,0 +1,216 @@
+package gitea_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice/gitea"
+)
+
+const testToken = "gitea-test"
+
+// pageSize emulates an instance configured with MAX_RESPONSE_ITEMS = 2
+const pageSize = 2
+
+// newTestServer emulates the gitea API v1 under /gitea
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	paginate := func(w http.ResponseWriter, r *http.Request,
+		items []map[string]interface{}, wrap bool) {
+		if r.Header.Get("Authorization") != "token "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"token is required"}`)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 {
+			t.Errorf("unexpected page %d", page)
+		}
+
+		start := (page - 1) * pageSize
+		end := start + pageSize
+		if start > len(items) {
+			start = len(items)
+		}
+		if end > len(items) {
+			end = len(items)
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+
+		var body interface{} = items[start:end]
+		if wrap {
+			body = map[string]interface{}{"ok": true, "data": body}
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+
+	mux.HandleFunc("/gitea/api/v1/orgs/infra/members",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, []map[string]interface{}{
+				{"login": "alice"}, {"login": "bob"}, {"login": "carol"},
+			}, false)
+		})
+
+	mux.HandleFunc("/gitea/api/v1/orgs/infra/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, []map[string]interface{}{
+				{"full_name": "infra/ansible", "fork": false,
+					"clone_url": "https://gitea.example.com/infra/ansible.git"},
+				{"full_name": "infra/terraform", "fork": false,
+					"clone_url": "https://gitea.example.com/infra/terraform.git"},
+				{"full_name": "infra/upstream", "fork": true,
+					"clone_url": "https://gitea.example.com/infra/upstream.git"},
+			}, false)
+		})
+
+	mux.HandleFunc("/gitea/api/v1/users/alice/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, []map[string]interface{}{
+				{"full_name": "alice/notes", "fork": false, "has_wiki": true,
+					"clone_url": "https://gitea.example.com/alice/notes.git"},
+			}, false)
+		})
+
+	mux.HandleFunc("/gitea/api/v1/users/search",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("q") != "ali" {
+				t.Errorf("expected q=ali, got %s", r.URL.RawQuery)
+			}
+
+			paginate(w, r, []map[string]interface{}{
+				{"login": "alice"}, {"login": "alina"}, {"login": "alison"},
+			}, true)
+		})
+
+	return httptest.NewServer(mux)
+}
+
+func newTestService(t *testing.T, srv *httptest.Server, token string) gitea.Service {
+	ctx := context.WithValue(context.Background(), git.MaxWorkerKey, 2)
+	gts, err := gitea.NewGiteaClientWithToken(ctx, srv.URL+"/gitea", token)
+	if err != nil {
+		t.Fatalf("failed to create gitea client, %v", err)
+	}
+	return gts
+}
+
+func userNames(users []git.User) []string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		if user.Type != git.GITEA {
+			names = append(names, "invalid type "+user.Type)
+		}
+		names = append(names, user.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListOrgUsers(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	users, err := newTestService(t, srv, testToken).
+		ListOrgUsers(context.Background(), "infra")
+	if err != nil {
+		t.Fatalf("failed to list org members, %v", err)
+	}
+
+	if got := fmt.Sprint(userNames(users)); got != "[alice bob carol]" {
+		t.Errorf("unexpected org members %s", got)
+	}
+}
+
+func TestListOrgRepositories(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	gts := newTestService(t, srv, testToken)
+
+	repos, err := gts.ListOrgRepositories(context.Background(), "infra", nil)
+	if err != nil {
+		t.Fatalf("failed to list org repositories, %v", err)
+	}
+
+	if len(repos) != 2 {
+		t.Errorf("expected 2 repositories without fork, got %d", len(repos))
+	}
+
+	repos, err = gts.ListOrgRepositories(context.Background(), "infra",
+		&git.ListRepositoriesOptions{WithFork: true})
+	if err != nil {
+		t.Fatalf("failed to list org repositories, %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Errorf("expected 3 repositories with fork, got %d", len(repos))
+	}
+}
+
+func TestListUserRepositories(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	repos, err := newTestService(t, srv, testToken).
+		ListUserRepositories(context.Background(), "alice", nil)
+	if err != nil {
+		t.Fatalf("failed to list user repositories, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].Name != "alice/notes" ||
+		repos[0].URL != "https://gitea.example.com/alice/notes.git" {
+		t.Errorf("unexpected user repositories %v", repos)
+	}
+
+	wiki := repos[0].Wiki()
+	if !repos[0].HasWiki || wiki.Kind != git.KindWiki ||
+		wiki.Name != "alice/notes.wiki" ||
+		wiki.URL != "https://gitea.example.com/alice/notes.wiki.git" {
+		t.Errorf("unexpected wiki repository %+v", wiki)
+	}
+}
+
+func TestFindUserFuzzy(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	users, err := newTestService(t, srv, testToken).
+		FindUserFuzzy(context.Background(), "ali")
+	if err != nil {
+		t.Fatalf("failed to search users, %v", err)
+	}
+
+	if got := fmt.Sprint(userNames(users)); got != "[alice alina alison]" {
+		t.Errorf("unexpected users %s", got)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	_, err := newTestService(t, srv, "invalid").
+		ListOrgUsers(context.Background(), "infra")
+
+	errResp, ok := err.(*gitea.ErrorResponse)
+	if !ok || errResp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 error response, got %v", err)
+	}
+}
+
+func TestInvalidBaseURL(t *testing.T) {
+	_, err := gitea.NewGiteaClientWithToken(context.Background(), "", testToken)
+	if err == nil {
+		t.Error("expected error for empty base url")
+	}
+}
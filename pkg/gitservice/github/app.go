@@ -0,0 +1,209 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// installationTokenUsername is the basic auth username for cloning with an
+	// installation token
+	installationTokenUsername = "x-access-token"
+
+	// JWTs are valid for at most 10 minutes, issued 60 seconds in the past to
+	// allow for clock drift
+	jwtLifetime  = 9 * time.Minute
+	jwtClockSkew = 60 * time.Second
+)
+
+var (
+	// ErrInvalidPrivateKey errors for GitHub App private key that is not a
+	// PEM encoded RSA private key
+	ErrInvalidPrivateKey = errors.New("github: invalid app private key")
+)
+
+// AppOptions is the GitHub App credential, the app authenticates as the
+// installation with a short-lived installation token
+type AppOptions struct {
+	// AppID is the GitHub App ID
+	AppID int64
+	// InstallationID is the installation ID of the app in the organization
+	InstallationID int64
+	// PrivateKey is the PEM encoded private key of the app
+	PrivateKey []byte
+}
+
+// appTransport authenticates the requests as the GitHub App with a JWT
+type appTransport struct {
+	transport http.RoundTripper
+	appID     int64
+	key       *rsa.PrivateKey
+}
+
+func (at *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := at.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrip should not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return at.transport.RoundTrip(req)
+}
+
+// jwt mints the RS256 signed JWT of the app
+func (at *appTransport) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(at.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, at.key, crypto.SHA256,
+		digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationTokenSource exchanges the app JWT for an installation token
+type installationTokenSource struct {
+	ctx            context.Context
+	client         *github.Client
+	installationID int64
+}
+
+func (its *installationTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := its.client.Apps.CreateInstallationToken(its.ctx,
+		its.installationID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+// appCredential clones with the installation token
+type appCredential struct {
+	ts oauth2.TokenSource
+}
+
+func (ac *appCredential) BasicAuth() (string, string, error) {
+	token, err := ac.ts.Token()
+	if err != nil {
+		return "", "", err
+	}
+
+	return installationTokenUsername, token.AccessToken, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	// GitHub generates PKCS#1 keys, PKCS#8 is accepted for converted keys
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %v", ErrInvalidPrivateKey, err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	return rsaKey, nil
+}
+
+// NewGithubAppClient create new github api client authenticated as a GitHub
+// App installation, the installation token is refreshed before it's expired
+// and used for cloning the listed repositories. Empty baseURL will use
+// api.github.com, see NewGithubEnterpriseClient for baseURL and uploadURL
+func NewGithubAppClient(ctx context.Context, baseURL, uploadURL string,
+	app AppOptions) (Service, error) {
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	appClient := github.NewClient(&http.Client{
+		Transport: &appTransport{
+			transport: http.DefaultTransport,
+			appID:     app.AppID,
+			key:       key,
+		},
+	})
+
+	if baseURL != "" {
+		if uploadURL == "" {
+			uploadURL = baseURL
+		}
+
+		appClient, err = github.NewEnterpriseClient(baseURL, uploadURL,
+			appClient.Client())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ts := oauth2.ReuseTokenSource(nil, &installationTokenSource{
+		ctx:            ctx,
+		client:         appClient,
+		installationID: app.InstallationID,
+	})
+
+	hc := oauth2.NewClient(ctx, ts)
+	hc.Transport = newRateLimitTransport(hc.Transport)
+
+	client := github.NewClient(hc)
+	client.BaseURL = appClient.BaseURL
+	client.UploadURL = appClient.UploadURL
+
+	ghs := newGithubService(ctx, client).(*githubService)
+	ghs.credential = &appCredential{ts: ts}
+
+	return ghs, nil
+}
@@ -0,0 +1,202 @@
+package github_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circleous/gitseer/pkg/gitservice/github"
+)
+
+const (
+	testAppID          = 7
+	testInstallationID = 42
+)
+
+// newAppTestServer emulates a GitHub Enterprise Server API under /api/v3, the
+// installation tokens expire after lifetime
+func newAppTestServer(t *testing.T, key *rsa.PrivateKey,
+	lifetime time.Duration, exchanges *int32) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(
+		fmt.Sprintf("/api/v3/app/installations/%d/access_tokens",
+			testInstallationID),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("expected POST, got %s", r.Method)
+			}
+
+			if err := verifyJWT(r.Header.Get("Authorization"),
+				&key.PublicKey); err != nil {
+				t.Errorf("invalid app jwt, %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			n := atomic.AddInt32(exchanges, 1)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      fmt.Sprintf("ghs_%d", n),
+				"expires_at": time.Now().Add(lifetime).Format(time.RFC3339),
+			})
+		})
+
+	mux.HandleFunc("/api/v3/orgs/acme/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ghs_") {
+				t.Errorf("expected installation token, got %q",
+					r.Header.Get("Authorization"))
+			}
+
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"full_name": "acme/private", "fork": false, "private": true,
+					"clone_url": "https://github.example.com/acme/private.git"},
+			})
+		})
+
+	return httptest.NewServer(mux)
+}
+
+func verifyJWT(authorization string, key *rsa.PublicKey) error {
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed jwt %q", authorization)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	if claims.Issuer != fmt.Sprint(testAppID) || claims.IssuedAt > now ||
+		claims.ExpiresAt < now || claims.ExpiresAt-claims.IssuedAt > 600 {
+		return fmt.Errorf("invalid claims %s", payload)
+	}
+
+	return nil
+}
+
+func newAppTestService(t *testing.T, lifetime time.Duration,
+	exchanges *int32) (github.Service, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key, %v", err)
+	}
+
+	srv := newAppTestServer(t, key, lifetime, exchanges)
+
+	ghs, err := github.NewGithubAppClient(context.Background(),
+		srv.URL+"/api/v3/", "", github.AppOptions{
+			AppID:          testAppID,
+			InstallationID: testInstallationID,
+			PrivateKey: pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			}),
+		})
+	if err != nil {
+		srv.Close()
+		t.Fatalf("failed to create github app client, %v", err)
+	}
+
+	return ghs, srv.Close
+}
+
+func TestAppInstallationToken(t *testing.T) {
+	var exchanges int32
+
+	ghs, closeServer := newAppTestService(t, time.Hour, &exchanges)
+	defer closeServer()
+
+	repos, err := ghs.ListOrgRepositories(context.Background(), "acme", nil)
+	if err != nil {
+		t.Fatalf("failed to list org repositories, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].Credential == nil {
+		t.Fatalf("expected 1 repository with credential, got %v", repos)
+	}
+
+	username, password, err := repos[0].Credential.BasicAuth()
+	if err != nil {
+		t.Fatalf("failed to get clone credential, %v", err)
+	}
+
+	if username != "x-access-token" || password != "ghs_1" {
+		t.Errorf("unexpected clone credential %s:%s", username, password)
+	}
+
+	// the token is reused until it's expired
+	if exchanges != 1 {
+		t.Errorf("expected 1 token exchange, got %d", exchanges)
+	}
+}
+
+func TestAppInstallationTokenRefresh(t *testing.T) {
+	var exchanges int32
+
+	// tokens expiring in a few seconds are already considered expired
+	ghs, closeServer := newAppTestService(t, time.Second, &exchanges)
+	defer closeServer()
+
+	repos, err := ghs.ListOrgRepositories(context.Background(), "acme", nil)
+	if err != nil || len(repos) != 1 {
+		t.Fatalf("failed to list org repositories, %v", err)
+	}
+
+	_, password, err := repos[0].Credential.BasicAuth()
+	if err != nil {
+		t.Fatalf("failed to get clone credential, %v", err)
+	}
+
+	if password != "ghs_2" {
+		t.Errorf("expected refreshed token ghs_2, got %s", password)
+	}
+}
+
+func TestAppInvalidPrivateKey(t *testing.T) {
+	_, err := github.NewGithubAppClient(context.Background(), "", "",
+		github.AppOptions{
+			AppID:          testAppID,
+			InstallationID: testInstallationID,
+			PrivateKey:     []byte("not a key"),
+		})
+	if err != github.ErrInvalidPrivateKey {
+		t.Errorf("expected ErrInvalidPrivateKey, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/google/go-github/v39/github"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+// ListRepositoryComments return the issue and pull request bodies, issue
+// comments, pull request review comments and commit comments of the
+// repository. repo is in owner/name format
+// revive:disable-next-line:line-length-limit
+func (ghs *githubService) ListRepositoryComments(ctx context.Context, repo string) ([]git.Comment, error) {
+	var comments []git.Comment
+
+	owner, name, err := splitFullName(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// issues also include the pull requests
+	err = paginate(func(page int) (*github.Response, error) {
+		issues, resp, err := ghs.client.Issues.ListByRepo(ctx, owner, name,
+			&github.IssueListByRepoOptions{
+				State:       "all",
+				ListOptions: github.ListOptions{PerPage: 100, Page: page},
+			})
+		for _, issue := range issues {
+			kind := "issues"
+			if issue.IsPullRequest() {
+				kind = "pull"
+			}
+
+			comments = append(comments, git.Comment{
+				Path: fmt.Sprintf("%s/%d", kind, issue.GetNumber()),
+				URL:  issue.GetHTMLURL(),
+				Body: issue.GetTitle() + "\n" + issue.GetBody(),
+			})
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = paginate(func(page int) (*github.Response, error) {
+		issueComments, resp, err := ghs.client.Issues.ListComments(ctx, owner,
+			name, 0, &github.IssueListCommentsOptions{
+				ListOptions: github.ListOptions{PerPage: 100, Page: page},
+			})
+		for _, comment := range issueComments {
+			comments = append(comments, git.Comment{
+				Path: fmt.Sprintf("issues/%s#issuecomment-%d",
+					path.Base(comment.GetIssueURL()), comment.GetID()),
+				URL:  comment.GetHTMLURL(),
+				Body: comment.GetBody(),
+			})
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = paginate(func(page int) (*github.Response, error) {
+		reviewComments, resp, err := ghs.client.PullRequests.ListComments(ctx,
+			owner, name, 0, &github.PullRequestListCommentsOptions{
+				ListOptions: github.ListOptions{PerPage: 100, Page: page},
+			})
+		for _, comment := range reviewComments {
+			comments = append(comments, git.Comment{
+				Path: fmt.Sprintf("pull/%s#discussion_r%d",
+					path.Base(comment.GetPullRequestURL()), comment.GetID()),
+				URL:  comment.GetHTMLURL(),
+				Body: comment.GetBody(),
+			})
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = paginate(func(page int) (*github.Response, error) {
+		commitComments, resp, err := ghs.client.Repositories.ListComments(ctx,
+			owner, name, &github.ListOptions{PerPage: 100, Page: page})
+		for _, comment := range commitComments {
+			comments = append(comments, git.Comment{
+				Path: fmt.Sprintf("commit/%s#commitcomment-%d",
+					comment.GetCommitID(), comment.GetID()),
+				URL:        comment.GetHTMLURL(),
+				CommitHash: comment.GetCommitID(),
+				Body:       comment.GetBody(),
+			})
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// paginate calls list from the first page until the last page sequentially
+func paginate(list func(page int) (*github.Response, error)) error {
+	page := 1
+	for {
+		resp, err := list(page)
+		if err != nil {
+			return err
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		page = resp.NextPage
+	}
+}
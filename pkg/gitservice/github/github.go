@@ -2,7 +2,10 @@ package github
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 
 	"github.com/google/go-github/v39/github"
@@ -15,49 +18,125 @@ import (
 type githubService struct {
 	client    *github.Client
 	maxWorker int
+	// credential is set to the listed repositories for cloning, nil for
+	// anonymous clone
+	credential git.Credential
 }
 
 // Service exported interface for github service
 type Service interface {
 	// ListOrgUsers return all users joined the organization
 	ListOrgUsers(ctx context.Context, org string) ([]git.User, error)
+	// ListOrgRepositories return all repositorises from an org
+	ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
 	// ListUserRepositories return all repositorises from a user / org
 	ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
 
 	FindUserFuzzy(ctx context.Context, query string) ([]git.User, error)
+
+	// ListUserGists return all public gists of a user, and the secret gists
+	// when the user is the token owner
+	ListUserGists(ctx context.Context, user string) ([]git.Repository, error)
+
+	// ListRepositoryComments return the issues, pull requests and their
+	// comments, and the commit comments of a repository in owner/name format
+	// revive:disable-next-line:line-length-limit
+	ListRepositoryComments(ctx context.Context, repo string) ([]git.Comment, error)
 }
 
 // NewGithubClient create plain new github api client without token, change max
 // worker in context.Value with gitservice.MaxWorkerKey as key
 func NewGithubClient(ctx context.Context) Service {
-	var maxWorker int
-	var ok bool
+	hc := &http.Client{
+		Transport: newRateLimitTransport(http.DefaultTransport),
+	}
 
-	hc := http.DefaultClient
-	hc.Transport = newRateLimitTransport(http.DefaultTransport)
-	client := github.NewClient(hc)
+	return newGithubService(ctx, github.NewClient(hc))
+}
 
-	if maxWorker, ok = ctx.Value(git.MaxWorkerKey).(int); !ok {
-		maxWorker = 10 // fallback
+// NewGithubClientWithToken create new github api client with token
+func NewGithubClientWithToken(ctx context.Context, token string) Service {
+	return NewGithubClientWithTokens(ctx, []string{token})
+}
+
+// NewGithubClientWithTokens create new github api client with a pool of
+// tokens, each request uses the token with the most remaining quota and a rate
+// limited token is switched to the other tokens. The first token is used for
+// cloning
+func NewGithubClientWithTokens(ctx context.Context, tokens []string) Service {
+	hc := newTokenHTTPClient(ctx, tokens)
+
+	ghs := newGithubService(ctx, github.NewClient(hc)).(*githubService)
+	ghs.credential = tokenCredential(tokens)
+
+	return ghs
+}
+
+// NewGithubEnterpriseClient create new github api client for a GitHub
+// Enterprise Server instance, baseURL is the API URL, e.g.
+// https://github.example.com/api/v3/, empty uploadURL will use baseURL. Tokens
+// are optional, see NewGithubClientWithTokens for multiple tokens
+func NewGithubEnterpriseClient(ctx context.Context, baseURL, uploadURL string,
+	tokens []string) (Service, error) {
+	var hc *http.Client
+
+	if uploadURL == "" {
+		uploadURL = baseURL
 	}
 
-	return &githubService{
-		client:    client,
-		maxWorker: maxWorker,
+	if len(tokens) > 0 {
+		hc = newTokenHTTPClient(ctx, tokens)
+	} else {
+		hc = &http.Client{
+			Transport: newRateLimitTransport(http.DefaultTransport),
+		}
 	}
+
+	client, err := github.NewEnterpriseClient(baseURL, uploadURL, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	ghs := newGithubService(ctx, client).(*githubService)
+	ghs.credential = tokenCredential(tokens)
+
+	return ghs, nil
 }
 
-// NewGithubClientWithToken create new github api client with token
-func NewGithubClientWithToken(ctx context.Context, token string) Service {
-	var maxWorker int
-	var ok bool
+// newTokenHTTPClient return the rate limited client, the tokens are rotated
+// when there are more than one token
+func newTokenHTTPClient(ctx context.Context, tokens []string) *http.Client {
+	if len(tokens) > 1 {
+		return &http.Client{
+			Transport: newRateLimitTransport(
+				newTokenPoolTransport(http.DefaultTransport, tokens)),
+		}
+	}
 
 	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
+		&oauth2.Token{AccessToken: tokens[0]},
 	)
 	hc := oauth2.NewClient(ctx, ts)
 	hc.Transport = newRateLimitTransport(hc.Transport)
-	client := github.NewClient(hc)
+
+	return hc
+}
+
+// tokenCredential return the clone credential of the first token
+func tokenCredential(tokens []string) git.Credential {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	return &git.BasicAuthCredential{
+		Username: installationTokenUsername,
+		Password: tokens[0],
+	}
+}
+
+func newGithubService(ctx context.Context, client *github.Client) Service {
+	var maxWorker int
+	var ok bool
 
 	if maxWorker, ok = ctx.Value(git.MaxWorkerKey).(int); !ok {
 		maxWorker = 10 // fallback
@@ -96,41 +175,12 @@ func (ghs *githubService) ListOrgUsers(ctx context.Context, org string) ([]git.U
 		})
 	}
 
-	for page := resp.NextPage; page < resp.LastPage; page++ {
+	for page := 2; page <= resp.LastPage; page++ {
 		sem.Acquire(ctx, 1)
 		page := page // copy
 		go func() {
-			gitUsers, _, err := ghs.client.Organizations.ListMembers(ctx, org,
-				&github.ListMembersOptions{
-					ListOptions: github.ListOptions{PerPage: 100, Page: page},
-				})
-			if err != nil {
-				return
-			}
+			defer sem.Release(1)
 
-			// rather than switch mutex every append(), better to switch one
-			// time so that it wont spent so much time on context switches
-			m.Lock()
-			for _, gitUser := range gitUsers {
-				users = append(users, git.User{
-					Name: *gitUser.Login,
-					Type: git.GITHUB,
-				})
-			}
-			m.Unlock()
-
-			sem.Release(1)
-		}()
-	}
-
-	// wait
-	if err := sem.Acquire(ctx, int64(ghs.maxWorker)); err != nil {
-		return nil, err
-	}
-	for page := resp.NextPage; page < resp.LastPage; page++ {
-		sem.Acquire(ctx, 1)
-		page := page // copy
-		go func() {
 			gitUsers, _, err := ghs.client.Organizations.ListMembers(ctx, org,
 				&github.ListMembersOptions{
 					ListOptions: github.ListOptions{PerPage: 100, Page: page},
@@ -149,8 +199,6 @@ func (ghs *githubService) ListOrgUsers(ctx context.Context, org string) ([]git.U
 				})
 			}
 			m.Unlock()
-
-			sem.Release(1)
 		}()
 	}
 
@@ -162,23 +210,62 @@ func (ghs *githubService) ListOrgUsers(ctx context.Context, org string) ([]git.U
 	return users, nil
 }
 
+// ListOrgRepositories return all repositorises in the organization, including
+// the private repositories visible to the token, when opt.WithFork is true,
+// return will also includes forked repositories
+// revive:disable-next-line:line-length-limit
+func (ghs *githubService) ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return ghs.listRepositories(ctx, opt,
+		func(page int) ([]*github.Repository, *github.Response, error) {
+			return ghs.client.Repositories.ListByOrg(ctx, org,
+				&github.RepositoryListByOrgOptions{
+					ListOptions: github.ListOptions{PerPage: 100, Page: page},
+				})
+		})
+}
+
 // ListUserRepositories return all repositorises given user, when opt.WithFork
 // is true, return will also includes forked repositories
 // revive:disable-next-line:line-length-limit
 func (ghs *githubService) ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return ghs.listRepositories(ctx, opt,
+		func(page int) ([]*github.Repository, *github.Response, error) {
+			return ghs.client.Repositories.List(ctx, user,
+				&github.RepositoryListOptions{
+					ListOptions: github.ListOptions{PerPage: 100, Page: page},
+				})
+		})
+}
+
+// listRepositories requests the first page with list to get the last page,
+// and the rest concurrently
+// revive:disable-next-line:line-length-limit
+func (ghs *githubService) listRepositories(ctx context.Context, opt *git.ListRepositoriesOptions, list func(page int) ([]*github.Repository, *github.Response, error)) ([]git.Repository, error) {
 	var m sync.Mutex
 	var repos []git.Repository
 
 	sem := semaphore.NewWeighted(int64(ghs.maxWorker))
 
-	if opt != nil {
+	if opt == nil {
 		opt = &git.DefaultListRepositoriesOpt
 	}
 
-	gitRepos, resp, err := ghs.client.Repositories.List(ctx, user,
-		&github.RepositoryListOptions{
-			ListOptions: github.ListOptions{PerPage: 100},
-		})
+	// forks are the indexes of the forked repositories in repos
+	var forks []int
+
+	collect := func(gitRepos []*github.Repository) {
+		for _, gitRepo := range gitRepos {
+			if gitRepo.GetFork() {
+				if !opt.WithFork {
+					continue
+				}
+				forks = append(forks, len(repos))
+			}
+			repos = append(repos, ghs.newRepository(gitRepo))
+		}
+	}
+
+	gitRepos, resp, err := list(1)
 	if err != nil {
 		return nil, err
 	}
@@ -187,56 +274,143 @@ func (ghs *githubService) ListUserRepositories(ctx context.Context, user string,
 		return nil, nil
 	}
 
-	for _, gitRepo := range gitRepos {
-		if *gitRepo.Fork && !opt.WithFork {
-			continue
-		}
-		repos = append(repos, git.Repository{
-			Name: *gitRepo.FullName,
-			URL:  *gitRepo.CloneURL,
-		})
-	}
+	collect(gitRepos)
 
-	errChan := make(chan error)
+	errs := make([]error, resp.LastPage+1)
 
-	for page := resp.NextPage; page < resp.LastPage; page++ {
+	for page := 2; page <= resp.LastPage; page++ {
 		sem.Acquire(ctx, 1)
 		page := page // copy
 		go func() {
-			gitRepos, _, err := ghs.client.Repositories.List(ctx, user,
-				&github.RepositoryListOptions{
-					ListOptions: github.ListOptions{PerPage: 100, Page: page},
-				})
+			defer sem.Release(1)
+
+			gitRepos, _, err := list(page)
 			if err != nil {
-				errChan <- err
+				errs[page] = err
 				return
 			}
 
 			// rather than switch mutex every append(), better to switch one
 			// time so that it wont spent so much time on context switches
 			m.Lock()
-			for _, gitRepo := range gitRepos {
-				if *gitRepo.Fork && !opt.WithFork {
-					continue
-				}
-				repos = append(repos, git.Repository{
-					Name:         *gitRepo.FullName,
-					URL:          *gitRepo.CloneURL,
-					LatestCommit: "",
-				})
-			}
+			collect(gitRepos)
 			m.Unlock()
-			sem.Release(1)
 		}()
 	}
-	close(errChan)
 
 	// wait
 	if err := sem.Acquire(ctx, int64(ghs.maxWorker)); err != nil {
 		return nil, err
 	}
 
-	err = <-errChan
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the listed repositories don't include their parent
+	if err := ghs.setUpstreams(ctx, repos, forks); err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// splitFullName splits the repository name in owner/name format
+func splitFullName(repo string) (string, string, error) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid repository name %q", repo)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// newRepository converts a github repository, it's cloned with the service
+// credential
+func (ghs *githubService) newRepository(gitRepo *github.Repository) git.Repository {
+	return git.Repository{
+		Name:       gitRepo.GetFullName(),
+		URL:        gitRepo.GetCloneURL(),
+		SSHURL:     gitRepo.GetSSHURL(),
+		HasWiki:    gitRepo.GetHasWiki(),
+		Credential: ghs.credential,
+	}
+}
+
+// setUpstreams requests each forked repository concurrently to set its parent
+// as the upstream, forks are the indexes of the forked repositories in repos
+// revive:disable-next-line:line-length-limit
+func (ghs *githubService) setUpstreams(ctx context.Context, repos []git.Repository, forks []int) error {
+	sem := semaphore.NewWeighted(int64(ghs.maxWorker))
+	errs := make([]error, len(forks))
+
+	for i, fork := range forks {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+
+		i, repo := i, &repos[fork] // copy
+		go func() {
+			defer sem.Release(1)
+
+			owner, name, err := splitFullName(repo.Name)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			gitRepo, _, err := ghs.client.Repositories.Get(ctx, owner, name)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			if parent := gitRepo.GetParent(); parent != nil {
+				upstream := ghs.newRepository(parent)
+				repo.Upstream = &upstream
+			}
+		}()
+	}
+
+	// wait
+	if err := sem.Acquire(ctx, int64(ghs.maxWorker)); err != nil {
+		return err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListUserGists return all gists of the user as repositories of KindGist, the
+// gist pages are requested sequentially, users rarely have more than a few
+// pages of gists
+// revive:disable-next-line:line-length-limit
+func (ghs *githubService) ListUserGists(ctx context.Context, user string) ([]git.Repository, error) {
+	var repos []git.Repository
+
+	err := paginate(func(page int) (*github.Response, error) {
+		gists, resp, err := ghs.client.Gists.List(ctx, user,
+			&github.GistListOptions{
+				ListOptions: github.ListOptions{PerPage: 100, Page: page},
+			})
+		for _, gist := range gists {
+			repos = append(repos, git.Repository{
+				Name:       gist.GetOwner().GetLogin() + "/" + gist.GetID(),
+				URL:        gist.GetGitPullURL(),
+				SSHURL:     gistSSHURL(gist.GetGitPullURL()),
+				Kind:       git.KindGist,
+				Credential: ghs.credential,
+			})
+		}
+		return resp, err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -244,6 +418,17 @@ func (ghs *githubService) ListUserRepositories(ctx context.Context, user string,
 	return repos, nil
 }
 
+// gistSSHURL return the SSH clone URL of the gist pull URL, e.g.
+// git@gist.github.com:<id>.git for https://gist.github.com/<id>.git
+func gistSSHURL(pullURL string) string {
+	u, err := url.Parse(pullURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return "git@" + u.Host + ":" + strings.TrimPrefix(u.Path, "/")
+}
+
 // FindUserFuzzy find users with fuzzy search github API
 func (ghs *githubService) FindUserFuzzy(ctx context.Context, query string) ([]git.User, error) {
 	var m sync.Mutex
@@ -270,10 +455,12 @@ func (ghs *githubService) FindUserFuzzy(ctx context.Context, query string) ([]gi
 		})
 	}
 
-	for page := resp.NextPage; page < resp.LastPage; page++ {
+	for page := 2; page <= resp.LastPage; page++ {
 		sem.Acquire(ctx, 1)
 		page := page // copy
 		go func() {
+			defer sem.Release(1)
+
 			sr, _, err := ghs.client.Search.Users(ctx, `type:user+`+query, &github.SearchOptions{
 				ListOptions: github.ListOptions{PerPage: 100, Page: page},
 			})
@@ -291,8 +478,6 @@ func (ghs *githubService) FindUserFuzzy(ctx context.Context, query string) ([]gi
 				})
 			}
 			m.Unlock()
-
-			sem.Release(1)
 		}()
 	}
 
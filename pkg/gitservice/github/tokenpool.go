@@ -0,0 +1,189 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// poolToken is a token of the pool with its last known rate limit
+type poolToken struct {
+	index int
+	token string
+
+	// limit and remaining are -1 until the first response
+	limit     int
+	remaining int
+	reset     time.Time
+	requests  int
+}
+
+// available return the remaining quota of the token, a token that is never
+// used is preferred, and an exhausted token is available again after reset
+func (pt *poolToken) available(now time.Time) int {
+	if pt.remaining < 0 {
+		return math.MaxInt32
+	}
+
+	if pt.remaining == 0 && now.After(pt.reset) {
+		return pt.limit
+	}
+
+	return pt.remaining
+}
+
+// tokenPoolTransport authenticates each request with the token with the most
+// remaining quota, a rate limited request is retried with the next token.
+// The rate limited response is only returned when every token is exhausted
+type tokenPoolTransport struct {
+	transport http.RoundTripper
+	tokens    []*poolToken
+
+	m sync.Mutex
+}
+
+// newTokenPoolTransport creates new roundtripper rotating tokens
+func newTokenPoolTransport(rt http.RoundTripper,
+	tokens []string) *tokenPoolTransport {
+	tpt := &tokenPoolTransport{transport: rt}
+
+	for i, token := range tokens {
+		tpt.tokens = append(tpt.tokens, &poolToken{
+			index:     i,
+			token:     token,
+			limit:     -1,
+			remaining: -1,
+		})
+	}
+
+	return tpt
+}
+
+// revive:disable-next-line:line-length-limit
+func (tpt *tokenPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the body can only be replayed with GetBody
+	retryable := req.Body == nil || req.Body == http.NoBody ||
+		req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		pt := tpt.pick()
+
+		r := req.Clone(req.Context())
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		r.Header.Set("Authorization", "Bearer "+pt.token)
+
+		resp, err := tpt.transport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !tpt.update(pt, resp) {
+			return resp, nil
+		}
+
+		if !retryable || attempt >= len(tpt.tokens) || !tpt.hasAvailable() {
+			tpt.logStats(log.Info().Int("token", pt.index)).
+				Msg("Token rate limit reached, no token to switch")
+			return resp, nil
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		tpt.logStats(log.Info().Int("token", pt.index)).
+			Msg("Token rate limit reached, switching token")
+	}
+}
+
+// pick return the token with the most remaining quota
+func (tpt *tokenPoolTransport) pick() *poolToken {
+	tpt.m.Lock()
+	defer tpt.m.Unlock()
+
+	now := time.Now()
+	best := tpt.tokens[0]
+	for _, pt := range tpt.tokens[1:] {
+		if pt.available(now) > best.available(now) {
+			best = pt
+		}
+	}
+	best.requests++
+
+	return best
+}
+
+// hasAvailable return true if any token has remaining quota
+func (tpt *tokenPoolTransport) hasAvailable() bool {
+	tpt.m.Lock()
+	defer tpt.m.Unlock()
+
+	now := time.Now()
+	for _, pt := range tpt.tokens {
+		if pt.available(now) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// update saves the rate limit headers of the response, it returns true if
+// the token is rate limited
+func (tpt *tokenPoolTransport) update(pt *poolToken,
+	resp *http.Response) bool {
+	tpt.m.Lock()
+	defer tpt.m.Unlock()
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return false
+	}
+	pt.remaining = remaining
+
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err == nil {
+		pt.limit = limit
+	}
+
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"),
+		10, 64); err == nil {
+		pt.reset = time.Unix(reset, 0)
+	}
+
+	log.Debug().Int("token", pt.index).Int("remaining", pt.remaining).
+		Int("limit", pt.limit).Time("reset", pt.reset).
+		Msg("Token rate limit")
+
+	return remaining == 0 && (resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusTooManyRequests)
+}
+
+// logStats adds the remaining quota of every token to the event
+func (tpt *tokenPoolTransport) logStats(e *zerolog.Event) *zerolog.Event {
+	tpt.m.Lock()
+	defer tpt.m.Unlock()
+
+	for _, pt := range tpt.tokens {
+		e = e.Dict(fmt.Sprintf("token_%d", pt.index), zerolog.Dict().
+			Int("remaining", pt.remaining).
+			Int("limit", pt.limit).
+			Time("reset", pt.reset).
+			Int("requests", pt.requests))
+	}
+
+	return e
+}
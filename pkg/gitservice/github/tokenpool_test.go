@@ -0,0 +1,129 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circleous/gitseer/pkg/gitservice/github"
+)
+
+// quotaServer emulates the primary rate limit of each token
+type quotaServer struct {
+	m         sync.Mutex
+	remaining map[string]int
+	requests  map[string]int
+}
+
+func (qs *quotaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	qs.m.Lock()
+	defer qs.m.Unlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	qs.requests[token]++
+
+	remaining, ok := qs.remaining[token]
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Reset",
+		strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+
+	if remaining == 0 {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+		return
+	}
+
+	qs.remaining[token] = remaining - 1
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining-1))
+	json.NewEncoder(w).Encode([]map[string]interface{}{
+		{"full_name": "acme/api", "fork": false,
+			"clone_url": "https://github.example.com/acme/api.git"},
+	})
+}
+
+func newQuotaService(t *testing.T, qs *quotaServer,
+	tokens []string) (github.Service, func()) {
+	srv := httptest.NewServer(qs)
+
+	ghs, err := github.NewGithubEnterpriseClient(context.Background(),
+		srv.URL+"/api/v3/", "", tokens)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("failed to create github client, %v", err)
+	}
+
+	return ghs, srv.Close
+}
+
+func TestTokenPoolSwitchOnRateLimit(t *testing.T) {
+	qs := &quotaServer{
+		remaining: map[string]int{"exhausted": 0, "fresh": 10},
+		requests:  make(map[string]int),
+	}
+
+	ghs, closeServer := newQuotaService(t, qs,
+		[]string{"exhausted", "fresh"})
+	defer closeServer()
+
+	repos, err := ghs.ListOrgRepositories(context.Background(), "acme", nil)
+	if err != nil {
+		t.Fatalf("expected the request to be retried with another token, %v",
+			err)
+	}
+
+	if len(repos) != 1 {
+		t.Errorf("expected 1 repository, got %d", len(repos))
+	}
+
+	if qs.requests["exhausted"] != 1 || qs.requests["fresh"] != 1 {
+		t.Errorf("unexpected requests per token %v", qs.requests)
+	}
+
+	// the exhausted token is not used until it's reset
+	for i := 0; i < 3; i++ {
+		if _, err := ghs.ListOrgRepositories(context.Background(), "acme",
+			nil); err != nil {
+			t.Fatalf("failed to list org repositories, %v", err)
+		}
+	}
+
+	if qs.requests["exhausted"] != 1 || qs.requests["fresh"] != 4 {
+		t.Errorf("unexpected requests per token %v", qs.requests)
+	}
+}
+
+func TestTokenPoolMostRemaining(t *testing.T) {
+	qs := &quotaServer{
+		remaining: map[string]int{"low": 2, "high": 100},
+		requests:  make(map[string]int),
+	}
+
+	ghs, closeServer := newQuotaService(t, qs, []string{"low", "high"})
+	defer closeServer()
+
+	// the first requests try the unused tokens, then the token with the most
+	// remaining quota is used
+	for i := 0; i < 5; i++ {
+		if _, err := ghs.ListOrgRepositories(context.Background(), "acme",
+			nil); err != nil {
+			t.Fatalf("failed to list org repositories, %v", err)
+		}
+	}
+
+	if qs.requests["low"] != 1 || qs.requests["high"] != 4 {
+		t.Errorf("unexpected requests per token %v", qs.requests)
+	}
+}
@@ -0,0 +1,212 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// DefaultBaseURL is the gitlab.com base URL
+	DefaultBaseURL = "https://gitlab.com/"
+
+	apiPath = "api/v4/"
+	perPage = 100
+)
+
+// client is a minimal GitLab REST API v4 client
+type client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	token      string
+}
+
+// ErrorResponse is returned when the API response status is not 2xx
+type ErrorResponse struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("gitlab: %d %s", e.StatusCode, e.Message)
+}
+
+func newClient(baseURL, token string) (*client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		httpClient: &http.Client{},
+		baseURL:    u.ResolveReference(&url.URL{Path: apiPath}),
+		token:      token,
+	}, nil
+}
+
+// pagination is the pagination headers of a response, total is 0 when the
+// API doesn't count the pages (more than 10,000 records)
+type pagination struct {
+	total int
+	next  int
+}
+
+// get requests the escaped path with query and decodes the JSON response into
+// v, it returns the pagination of the response
+func (c *client) get(ctx context.Context, path string, query url.Values,
+	v interface{}) (pagination, error) {
+	var p pagination
+
+	u, err := url.Parse(c.baseURL.String() + path)
+	if err != nil {
+		return p, err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return p, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return p, err
+	}
+	defer resp.Body.Close()
+
+	// When you have been limited, use the Retry-After response header to slow
+	// down.
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		log.Debug().Msgf("Rate limit reached, sleeping for %ds", retryAfter)
+
+		select {
+		case <-time.After(time.Duration(retryAfter) * time.Second):
+		case <-ctx.Done():
+			return p, ctx.Err()
+		}
+
+		return c.get(ctx, path, query, v)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var body struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		msg := body.Error
+		if body.Message != nil {
+			msg = fmt.Sprint(body.Message)
+		}
+
+		return p, &ErrorResponse{StatusCode: resp.StatusCode, Message: msg}
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return p, err
+	}
+
+	p.total, _ = strconv.Atoi(resp.Header.Get("X-Total-Pages"))
+	p.next, _ = strconv.Atoi(resp.Header.Get("X-Next-Page"))
+
+	return p, nil
+}
+
+// getAll requests every page of path, newPage is called to allocate the
+// decoded page and collect is called with each decoded page. The first page
+// is requested to get the total pages and the rest are requested concurrently
+// with at most maxWorker requests, or one by one if the total is unknown
+func (c *client) getAll(ctx context.Context, maxWorker int, path string,
+	query url.Values, newPage func() interface{},
+	collect func(page interface{})) error {
+	var m sync.Mutex
+
+	if query == nil {
+		query = url.Values{}
+	}
+
+	withPage := func(page int) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("per_page", strconv.Itoa(perPage))
+		q.Set("page", strconv.Itoa(page))
+		return q
+	}
+
+	first := newPage()
+	p, err := c.get(ctx, path, withPage(1), first)
+	if err != nil {
+		return err
+	}
+	collect(first)
+
+	for p.total == 0 && p.next > 0 {
+		v := newPage()
+		if p, err = c.get(ctx, path, withPage(p.next), v); err != nil {
+			return err
+		}
+		collect(v)
+	}
+
+	sem := semaphore.NewWeighted(int64(maxWorker))
+	errs := make([]error, p.total+1)
+
+	for page := 2; page <= p.total; page++ {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+
+		page := page // copy
+		go func() {
+			defer sem.Release(1)
+
+			v := newPage()
+			if _, err := c.get(ctx, path, withPage(page), v); err != nil {
+				errs[page] = err
+				return
+			}
+
+			m.Lock()
+			collect(v)
+			m.Unlock()
+		}()
+	}
+
+	// wait
+	if err := sem.Acquire(ctx, int64(maxWorker)); err != nil {
+		return err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
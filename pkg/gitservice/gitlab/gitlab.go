@@ -0,0 +1,168 @@
+package gitlab
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/circleous/gitseer/pkg/git"
+)
+
+type gitlabService struct {
+	client    *client
+	maxWorker int
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	HTTPURLToRepo     string `json:"http_url_to_repo"`
+	SSHURLToRepo      string `json:"ssh_url_to_repo"`
+	WikiEnabled       bool   `json:"wiki_enabled"`
+	ForkedFromProject *struct {
+		ID int `json:"id"`
+	} `json:"forked_from_project"`
+}
+
+// Service exported interface for gitlab service
+type Service interface {
+	// ListOrgUsers return all users joined the group, including the inherited
+	// members
+	ListOrgUsers(ctx context.Context, group string) ([]git.User, error)
+	// ListOrgRepositories return all projects in the group and its subgroups
+	// revive:disable-next-line:line-length-limit
+	ListOrgRepositories(ctx context.Context, group string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+	// ListUserRepositories return all projects owned by a user
+	// revive:disable-next-line:line-length-limit
+	ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+
+	FindUserFuzzy(ctx context.Context, query string) ([]git.User, error)
+}
+
+// NewGitlabClient create plain new gitlab api client without token, baseURL is
+// the gitlab instance URL, e.g. https://gitlab.example.com/, empty baseURL
+// will use gitlab.com. Change max worker in context.Value with
+// gitservice.MaxWorkerKey as key
+func NewGitlabClient(ctx context.Context, baseURL string) (Service, error) {
+	return NewGitlabClientWithToken(ctx, baseURL, "")
+}
+
+// NewGitlabClientWithToken create new gitlab api client with personal access
+// token
+func NewGitlabClientWithToken(ctx context.Context, baseURL,
+	token string) (Service, error) {
+	var maxWorker int
+	var ok bool
+
+	c, err := newClient(baseURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxWorker, ok = ctx.Value(git.MaxWorkerKey).(int); !ok {
+		maxWorker = 10 // fallback
+	}
+
+	return &gitlabService{
+		client:    c,
+		maxWorker: maxWorker,
+	}, nil
+}
+
+// ListOrgUsers return all gitlab users joined the group
+// revive:disable-next-line:line-length-limit
+func (gls *gitlabService) ListOrgUsers(ctx context.Context, group string) ([]git.User, error) {
+	var users []git.User
+
+	err := gls.client.getAll(ctx, gls.maxWorker,
+		"groups/"+url.PathEscape(group)+"/members/all", nil,
+		func() interface{} { return &[]gitlabUser{} },
+		func(page interface{}) {
+			for _, gitUser := range *page.(*[]gitlabUser) {
+				users = append(users, git.User{
+					Name: gitUser.Username,
+					Type: git.GITLAB,
+				})
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListOrgRepositories return all projects in the group and its subgroups, when
+// opt.WithFork is true, return will also includes forked projects
+// revive:disable-next-line:line-length-limit
+func (gls *gitlabService) ListOrgRepositories(ctx context.Context, group string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return gls.listProjects(ctx, "groups/"+url.PathEscape(group)+"/projects",
+		url.Values{"include_subgroups": {"true"}}, opt)
+}
+
+// ListUserRepositories return all projects given user, when opt.WithFork is
+// true, return will also includes forked projects
+// revive:disable-next-line:line-length-limit
+func (gls *gitlabService) ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	return gls.listProjects(ctx, "users/"+url.PathEscape(user)+"/projects",
+		nil, opt)
+}
+
+// revive:disable-next-line:line-length-limit
+func (gls *gitlabService) listProjects(ctx context.Context, path string, query url.Values, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
+	var repos []git.Repository
+
+	if opt == nil {
+		opt = &git.DefaultListRepositoriesOpt
+	}
+
+	err := gls.client.getAll(ctx, gls.maxWorker, path, query,
+		func() interface{} { return &[]gitlabProject{} },
+		func(page interface{}) {
+			for _, project := range *page.(*[]gitlabProject) {
+				if project.ForkedFromProject != nil && !opt.WithFork {
+					continue
+				}
+				repos = append(repos, git.Repository{
+					Name:    project.PathWithNamespace,
+					URL:     project.HTTPURLToRepo,
+					SSHURL:  project.SSHURLToRepo,
+					HasWiki: project.WikiEnabled,
+				})
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// FindUserFuzzy find users with gitlab user search API
+// revive:disable-next-line:line-length-limit
+func (gls *gitlabService) FindUserFuzzy(ctx context.Context, query string) ([]git.User, error) {
+	users := make([]git.User, 0)
+
+	err := gls.client.getAll(ctx, gls.maxWorker, "users",
+		url.Values{"search": {query}},
+		func() interface{} { return &[]gitlabUser{} },
+		func(page interface{}) {
+			for _, gitUser := range *page.(*[]gitlabUser) {
+				users = append(users, git.User{
+					Name: gitUser.Username,
+					Type: git.GITLAB,
+				})
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users, nil
+}
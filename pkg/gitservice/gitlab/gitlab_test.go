@@ -0,0 +1,231 @@
+package gitlab_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice/gitlab"
+)
+
+const testToken = "glpat-test"
+
+// newTestServer emulates a self-hosted gitlab instance under /gitlab, every
+// endpoint returns two pages
+func newTestServer(t *testing.T) *httptest.Server {
+	// dispatch on the escaped path, group paths must keep %2F
+	handlers := make(map[string]http.HandlerFunc)
+
+	paginate := func(w http.ResponseWriter, r *http.Request,
+		pages [][]map[string]interface{}) {
+		if r.Header.Get("PRIVATE-TOKEN") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"401 Unauthorized"}`)
+			return
+		}
+
+		if r.URL.Query().Get("per_page") != "100" {
+			t.Errorf("expected per_page=100, got %s", r.URL.RawQuery)
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(pages) {
+			t.Errorf("unexpected page %d", page)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Total-Pages", strconv.Itoa(len(pages)))
+		if page < len(pages) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		json.NewEncoder(w).Encode(pages[page-1])
+	}
+
+	handlers["/gitlab/api/v4/groups/parent%2Fchild/members/all"] =
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, [][]map[string]interface{}{
+				{{"username": "alice"}, {"username": "bob"}},
+				{{"username": "carol"}},
+			})
+		}
+
+	handlers["/gitlab/api/v4/groups/parent%2Fchild/projects"] =
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("include_subgroups") != "true" {
+				t.Errorf("expected include_subgroups=true, got %s",
+					r.URL.RawQuery)
+			}
+
+			paginate(w, r, [][]map[string]interface{}{
+				{{
+					"path_with_namespace": "parent/child/api",
+					"http_url_to_repo":    "https://gitlab.example.com/parent/child/api.git",
+				}},
+				{{
+					"path_with_namespace": "parent/child/sub/web",
+					"http_url_to_repo":    "https://gitlab.example.com/parent/child/sub/web.git",
+				}, {
+					"path_with_namespace": "parent/child/fork",
+					"http_url_to_repo":    "https://gitlab.example.com/parent/child/fork.git",
+					"forked_from_project": map[string]interface{}{"id": 1},
+				}},
+			})
+		}
+
+	handlers["/gitlab/api/v4/users/alice/projects"] =
+		func(w http.ResponseWriter, r *http.Request) {
+			paginate(w, r, [][]map[string]interface{}{
+				{{
+					"path_with_namespace": "alice/dotfiles",
+					"http_url_to_repo":    "https://gitlab.example.com/alice/dotfiles.git",
+				}},
+				{},
+			})
+		}
+
+	handlers["/gitlab/api/v4/users"] =
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("search") != "ali" {
+				t.Errorf("expected search=ali, got %s", r.URL.RawQuery)
+			}
+
+			paginate(w, r, [][]map[string]interface{}{
+				{{"username": "alice"}},
+				{{"username": "alina"}},
+			})
+		}
+
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			handler, ok := handlers[r.URL.EscapedPath()]
+			if !ok {
+				t.Errorf("unexpected path %s", r.URL.EscapedPath())
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			handler(w, r)
+		}))
+}
+
+func newTestService(t *testing.T, srv *httptest.Server, token string) gitlab.Service {
+	ctx := context.WithValue(context.Background(), git.MaxWorkerKey, 2)
+	gls, err := gitlab.NewGitlabClientWithToken(ctx, srv.URL+"/gitlab", token)
+	if err != nil {
+		t.Fatalf("failed to create gitlab client, %v", err)
+	}
+	return gls
+}
+
+func repoNames(repos []git.Repository) []string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func userNames(users []git.User) []string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		if user.Type != git.GITLAB {
+			names = append(names, "invalid type "+user.Type)
+		}
+		names = append(names, user.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListOrgUsers(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	users, err := newTestService(t, srv, testToken).
+		ListOrgUsers(context.Background(), "parent/child")
+	if err != nil {
+		t.Fatalf("failed to list group members, %v", err)
+	}
+
+	if got := fmt.Sprint(userNames(users)); got != "[alice bob carol]" {
+		t.Errorf("unexpected group members %s", got)
+	}
+}
+
+func TestListOrgRepositories(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	gls := newTestService(t, srv, testToken)
+
+	repos, err := gls.ListOrgRepositories(context.Background(), "parent/child",
+		&git.ListRepositoriesOptions{WithFork: false})
+	if err != nil {
+		t.Fatalf("failed to list group projects, %v", err)
+	}
+
+	got := fmt.Sprint(repoNames(repos))
+	if got != "[parent/child/api parent/child/sub/web]" {
+		t.Errorf("unexpected group projects %s", got)
+	}
+
+	repos, err = gls.ListOrgRepositories(context.Background(), "parent/child",
+		&git.ListRepositoriesOptions{WithFork: true})
+	if err != nil {
+		t.Fatalf("failed to list group projects, %v", err)
+	}
+
+	if len(repos) != 3 {
+		t.Errorf("expected 3 projects with fork, got %d", len(repos))
+	}
+}
+
+func TestListUserRepositories(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	repos, err := newTestService(t, srv, testToken).
+		ListUserRepositories(context.Background(), "alice", nil)
+	if err != nil {
+		t.Fatalf("failed to list user projects, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].URL != "https://gitlab.example.com/alice/dotfiles.git" {
+		t.Errorf("unexpected user projects %v", repos)
+	}
+}
+
+func TestFindUserFuzzy(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	users, err := newTestService(t, srv, testToken).
+		FindUserFuzzy(context.Background(), "ali")
+	if err != nil {
+		t.Fatalf("failed to search users, %v", err)
+	}
+
+	if got := fmt.Sprint(userNames(users)); got != "[alice alina]" {
+		t.Errorf("unexpected users %s", got)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	_, err := newTestService(t, srv, "invalid").
+		ListOrgUsers(context.Background(), "parent/child")
+
+	errResp, ok := err.(*gitlab.ErrorResponse)
+	if !ok || errResp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 error response, got %v", err)
+	}
+}
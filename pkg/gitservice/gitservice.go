@@ -3,15 +3,30 @@ package gitservice
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
 
 	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice/bitbucket"
+	"github.com/circleous/gitseer/pkg/gitservice/gitea"
 	"github.com/circleous/gitseer/pkg/gitservice/github"
+	"github.com/circleous/gitseer/pkg/gitservice/gitlab"
 )
 
 var (
 	defaultGitServiceOptions = Options{}
 	// ErrInvalidServiceType errors for invlid service type
 	ErrInvalidServiceType = errors.New("invalid service type")
+	// ErrServiceNotConfigured errors for service type without a required
+	// option, e.g. self-hosted only service without base URL
+	ErrServiceNotConfigured = errors.New("service is not configured")
+	// ErrGistNotSupported errors for service without gists, only github has
+	// gists
+	ErrGistNotSupported = errors.New("gist is not supported by the service")
+	// ErrCommentNotSupported errors for service without listing repository
+	// comments, only github is supported
+	ErrCommentNotSupported = errors.New(
+		"comment is not supported by the service")
 )
 
 // Service is the interface the gitservice
@@ -27,83 +42,426 @@ type Service interface {
 	ListUserRepositories(ctx context.Context, serviceType string, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
 
 	FindUserFuzzy(ctx context.Context, serviceType string, query string) ([]git.User, error)
+
+	// ListUserGists return all gists from a user as repositories, only github
+	// services have gists
+	// revive:disable-next-line:line-length-limit
+	ListUserGists(ctx context.Context, serviceType string, user string) ([]git.Repository, error)
+
+	// ListRepositoryComments return the issues, pull requests, their comments
+	// and the commit comments of a repository, only github services are
+	// supported
+	// revive:disable-next-line:line-length-limit
+	ListRepositoryComments(ctx context.Context, serviceType string, repo string) ([]git.Comment, error)
 }
 
 // Options is the option struct when creating GitService
 type Options struct {
-	// GitlabToken string
-
 	// GithubToken personal access token for accessing the github api
 	GithubToken string
+	// GithubTokens are more personal access tokens, the tokens are rotated
+	// with GithubToken by their remaining quota
+	GithubTokens []string
+	// GithubApp authenticates as a GitHub App installation instead of
+	// GithubToken when the app ID is set, the installation token is also used
+	// for cloning
+	GithubApp github.AppOptions
+
+	// GitlabToken personal access token for accessing the gitlab api
+	GitlabToken string
+	// GitlabBaseURL is the self-hosted gitlab instance URL, default to
+	// gitlab.com
+	GitlabBaseURL string
+
+	// GiteaToken access token for accessing the gitea api
+	GiteaToken string
+	// GiteaBaseURL is the gitea or forgejo instance URL, gitea service is only
+	// available when it's set
+	GiteaBaseURL string
+
+	// BitbucketUsername is the bitbucket cloud username, BitbucketToken is
+	// used as app password when it's set, else as access token
+	BitbucketUsername string
+	// BitbucketToken app password or access token for the bitbucket cloud api
+	BitbucketToken string
+	// BitbucketBaseURL is the bitbucket cloud API URL, default to
+	// api.bitbucket.org
+	BitbucketBaseURL string
+
+	// BitbucketServerUsername is the bitbucket server username,
+	// BitbucketServerToken is used as password when it's set, else as HTTP
+	// access token
+	BitbucketServerUsername string
+	// BitbucketServerToken password or HTTP access token for the bitbucket
+	// server api
+	BitbucketServerToken string
+	// BitbucketServerBaseURL is the bitbucket server / data center instance
+	// URL, bitbucket_server service is only available when it's set
+	BitbucketServerBaseURL string
+
+	// Services are additional named services, e.g. GitHub Enterprise Server
+	Services []ServiceOptions
+}
+
+// ServiceOptions is a named git service, used to scan another host of a
+// service type, e.g. GitHub Enterprise Server alongside github.com
+type ServiceOptions struct {
+	// Name is the service name used as the organization / user type, a name
+	// of a service type replaces the default service of that type
+	Name string
+	// Type is the service type, one of [github, gitlab, gitea, bitbucket,
+	// bitbucket_server]
+	Type string
+	// BaseURL is the API URL for github, e.g.
+	// https://github.example.com/api/v3/, or the instance URL for the others
+	BaseURL string
+	// UploadURL is the github upload API URL, default to BaseURL
+	UploadURL string
+	// Username is used with Token as password for bitbucket
+	Username string
+	// Token is the access token of the service
+	Token string
+	// Tokens are more github access tokens rotated with Token
+	Tokens []string
+	// GithubApp is the GitHub App credential used instead of Token for github
+	// when the app ID is set
+	GithubApp github.AppOptions
 }
 
-// GitService holds reference to multiple service
+// backend is the interface implemented by every service type
+type backend interface {
+	ListOrgUsers(ctx context.Context, org string) ([]git.User, error)
+	// revive:disable-next-line:line-length-limit
+	ListOrgRepositories(ctx context.Context, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+	// revive:disable-next-line:line-length-limit
+	ListUserRepositories(ctx context.Context, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error)
+	FindUserFuzzy(ctx context.Context, query string) ([]git.User, error)
+}
+
+// gistBackend is implemented by the service types with gists
+type gistBackend interface {
+	ListUserGists(ctx context.Context, user string) ([]git.Repository, error)
+}
+
+// commentBackend is implemented by the service types listing repository
+// comments
+type commentBackend interface {
+	// revive:disable-next-line:line-length-limit
+	ListRepositoryComments(ctx context.Context, repo string) ([]git.Comment, error)
+}
+
+// GitService holds reference to multiple service, keyed by the service type or
+// name. A nil service is a known service that is not configured
 type gitService struct {
-	// ghl *GitlabService
-	ghs github.Service
+	services map[string]backend
+	// credentials are the clone credentials from the service tokens
+	credentials map[string]git.Credential
 }
 
 // NewGitService a wrapper around the available git service api for listing
-func NewGitService(ctx context.Context, opt *Options) Service {
+func NewGitService(ctx context.Context, opt *Options) (Service, error) {
 	var githubSvc github.Service
+	var gitlabSvc gitlab.Service
+	var giteaSvc gitea.Service
+	var bitbucketCloudSvc, bitbucketServerSvc bitbucket.Service
+	var err error
 
 	if opt == nil {
 		opt = &defaultGitServiceOptions
 	}
 
-	if opt.GithubToken != "" {
-		githubSvc = github.NewGithubClientWithToken(ctx, opt.GithubToken)
+	if opt.GithubApp.AppID != 0 {
+		githubSvc, err = github.NewGithubAppClient(ctx, "", "", opt.GithubApp)
+		if err != nil {
+			return nil, err
+		}
+	} else if tokens := githubTokens(opt.GithubToken,
+		opt.GithubTokens); len(tokens) > 0 {
+		githubSvc = github.NewGithubClientWithTokens(ctx, tokens)
 	} else {
 		githubSvc = github.NewGithubClient(ctx)
 	}
 
-	return &gitService{
-		ghs: githubSvc,
+	if opt.GitlabToken != "" {
+		gitlabSvc, err = gitlab.NewGitlabClientWithToken(ctx,
+			opt.GitlabBaseURL, opt.GitlabToken)
+	} else {
+		gitlabSvc, err = gitlab.NewGitlabClient(ctx, opt.GitlabBaseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.GiteaBaseURL != "" {
+		giteaSvc, err = gitea.NewGiteaClientWithToken(ctx, opt.GiteaBaseURL,
+			opt.GiteaToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bitbucketCloudSvc, err = bitbucket.NewBitbucketCloudClient(ctx,
+		opt.BitbucketBaseURL, opt.BitbucketUsername, opt.BitbucketToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.BitbucketServerBaseURL != "" {
+		bitbucketServerSvc, err = bitbucket.NewBitbucketServerClient(ctx,
+			opt.BitbucketServerBaseURL, opt.BitbucketServerUsername,
+			opt.BitbucketServerToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gs := &gitService{
+		services: map[string]backend{
+			git.GITHUB:          githubSvc,
+			git.GITLAB:          gitlabSvc,
+			git.GITEA:           giteaSvc,
+			git.BITBUCKET:       bitbucketCloudSvc,
+			git.BITBUCKETSERVER: bitbucketServerSvc,
+		},
+		credentials: map[string]git.Credential{
+			git.GITLAB: tokenCredential(git.GITLAB, "", opt.GitlabToken),
+			git.GITEA:  tokenCredential(git.GITEA, "", opt.GiteaToken),
+			git.BITBUCKET: tokenCredential(git.BITBUCKET,
+				opt.BitbucketUsername, opt.BitbucketToken),
+			git.BITBUCKETSERVER: tokenCredential(git.BITBUCKETSERVER,
+				opt.BitbucketServerUsername, opt.BitbucketServerToken),
+		},
+	}
+
+	for _, svcOpt := range opt.Services {
+		svc, err := newNamedService(ctx, svcOpt)
+		if err != nil {
+			return nil, err
+		}
+		gs.services[svcOpt.Name] = svc
+		if svcOpt.Type != git.GITHUB {
+			gs.credentials[svcOpt.Name] = tokenCredential(svcOpt.Type,
+				svcOpt.Username, svcOpt.Token)
+		}
+	}
+
+	return gs, nil
+}
+
+// tokenCredential return the HTTP basic auth clone credential of the service
+// token, or nil without token. github sets the credential of its repositories
+func tokenCredential(serviceType, username, token string) git.Credential {
+	if token == "" {
+		return nil
+	}
+
+	if username == "" {
+		switch serviceType {
+		case git.GITLAB, git.GITEA:
+			username = "oauth2"
+		default:
+			username = "x-token-auth"
+		}
+	}
+
+	return &git.BasicAuthCredential{Username: username, Password: token}
+}
+
+// githubTokens return the non-empty tokens of token and tokens
+func githubTokens(token string, tokens []string) []string {
+	var all []string
+
+	for _, t := range append([]string{token}, tokens...) {
+		if t != "" {
+			all = append(all, t)
+		}
+	}
+
+	return all
+}
+
+// newNamedService create the service of svcOpt.Type
+func newNamedService(ctx context.Context, svcOpt ServiceOptions) (backend,
+	error) {
+	if svcOpt.Name == "" {
+		return nil, fmt.Errorf("service name is required for type %q",
+			svcOpt.Type)
+	}
+
+	switch svcOpt.Type {
+	case git.GITHUB:
+		if svcOpt.GithubApp.AppID != 0 {
+			return github.NewGithubAppClient(ctx, svcOpt.BaseURL,
+				svcOpt.UploadURL, svcOpt.GithubApp)
+		}
+		tokens := githubTokens(svcOpt.Token, svcOpt.Tokens)
+		if svcOpt.BaseURL != "" {
+			return github.NewGithubEnterpriseClient(ctx, svcOpt.BaseURL,
+				svcOpt.UploadURL, tokens)
+		}
+		if len(tokens) == 0 {
+			return github.NewGithubClient(ctx), nil
+		}
+		return github.NewGithubClientWithTokens(ctx, tokens), nil
+	case git.GITLAB:
+		return gitlab.NewGitlabClientWithToken(ctx, svcOpt.BaseURL,
+			svcOpt.Token)
+	case git.GITEA:
+		return gitea.NewGiteaClientWithToken(ctx, svcOpt.BaseURL, svcOpt.Token)
+	case git.BITBUCKET:
+		return bitbucket.NewBitbucketCloudClient(ctx, svcOpt.BaseURL,
+			svcOpt.Username, svcOpt.Token)
+	case git.BITBUCKETSERVER:
+		return bitbucket.NewBitbucketServerClient(ctx, svcOpt.BaseURL,
+			svcOpt.Username, svcOpt.Token)
+	}
+
+	return nil, fmt.Errorf("service %q: %w", svcOpt.Name,
+		ErrInvalidServiceType)
+}
+
+// service return the service of serviceType, which is a service type or a
+// configured service name
+func (gs *gitService) service(serviceType string) (backend, error) {
+	svc, ok := gs.services[serviceType]
+	if !ok {
+		return nil, ErrInvalidServiceType
+	}
+
+	if svc == nil {
+		return nil, ErrServiceNotConfigured
+	}
+
+	return svc, nil
+}
+
+// withType sets the user type to serviceType, users of a named service are
+// listed from the same service
+func withType(users []git.User, serviceType string) []git.User {
+	for i := range users {
+		users[i].Type = serviceType
+	}
+
+	return users
+}
+
+// withRepository tags the repositories and their upstream with the host of
+// their clone URL, the service and the service clone credential
+func (gs *gitService) withRepository(repos []git.Repository,
+	serviceType string) []git.Repository {
+	for i := range repos {
+		gs.tagRepository(&repos[i], serviceType)
+
+		if repos[i].Upstream != nil {
+			gs.tagRepository(repos[i].Upstream, serviceType)
+		}
+	}
+
+	return repos
+}
+
+func (gs *gitService) tagRepository(repo *git.Repository, serviceType string) {
+	repo.Service = serviceType
+
+	// don't replace the credential of the backend, e.g. GitHub App
+	// installation token
+	if repo.Credential == nil {
+		repo.Credential = gs.credentials[serviceType]
+	}
+
+	if repo.Host != "" {
+		return
+	}
+
+	if u, err := url.Parse(repo.URL); err == nil {
+		repo.Host = u.Host
 	}
 }
 
 // ListOrgUsers return all users joined the organization, valid serviceTypes are
-// [github, gitlab]
+// [github, gitlab, gitea, bitbucket, bitbucket_server] or a configured service
+// name
 func (gs *gitService) ListOrgUsers(ctx context.Context, serviceType string, org string) ([]git.User, error) {
-	switch serviceType {
-	case git.GITHUB:
-		return gs.ghs.ListOrgUsers(ctx, org)
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrInvalidServiceType
+	users, err := svc.ListOrgUsers(ctx, org)
+	return withType(users, serviceType), err
 }
 
 // ListOrgRepositories return all repositorises in the organization, valid
-// serviceTypes are [github, gitlab], when opt.WithFork is true, return will
-// also includes forked repositories
+// serviceTypes are [github, gitlab, gitea, bitbucket, bitbucket_server] or a
+// configured service name, when opt.WithFork is true, return will also
+// includes forked repositories
 // revive:disable-next-line:line-length-limit
 func (gs *gitService) ListOrgRepositories(ctx context.Context, serviceType string, org string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
-	switch serviceType {
-	case git.GITHUB:
-		return gs.ghs.ListUserRepositories(ctx, org, opt)
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrInvalidServiceType
+	repos, err := svc.ListOrgRepositories(ctx, org, opt)
+	return gs.withRepository(repos, serviceType), err
 }
 
 // ListUserRepositories return all repositorises given user, valid serviceTypes
-// are [github, gitlab] when opt.WithFork is true, return will also includes
-// forked repositories
+// are [github, gitlab, gitea, bitbucket, bitbucket_server] or a configured
+// service name, when opt.WithFork is true, return will also includes forked
+// repositories
 // revive:disable-next-line:line-length-limit
 func (gs *gitService) ListUserRepositories(ctx context.Context, serviceType string, user string, opt *git.ListRepositoriesOptions) ([]git.Repository, error) {
-	switch serviceType {
-	case git.GITHUB:
-		return gs.ghs.ListUserRepositories(ctx, user, opt)
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrInvalidServiceType
+	repos, err := svc.ListUserRepositories(ctx, user, opt)
+	return gs.withRepository(repos, serviceType), err
 }
 
 func (gs *gitService) FindUserFuzzy(ctx context.Context, serviceType string, query string) ([]git.User, error) {
-	switch serviceType {
-	case git.GITHUB:
-		return gs.ghs.FindUserFuzzy(ctx, query)
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := svc.FindUserFuzzy(ctx, query)
+	return withType(users, serviceType), err
+}
+
+// ListUserGists return all gists from a user, valid serviceTypes are github or
+// a configured github service name
+// revive:disable-next-line:line-length-limit
+func (gs *gitService) ListUserGists(ctx context.Context, serviceType string, user string) ([]git.Repository, error) {
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	gistSvc, ok := svc.(gistBackend)
+	if !ok {
+		return nil, ErrGistNotSupported
+	}
+
+	repos, err := gistSvc.ListUserGists(ctx, user)
+	return gs.withRepository(repos, serviceType), err
+}
+
+// ListRepositoryComments return the comments of a repository in owner/name
+// format, valid serviceTypes are github or a configured github service name
+// revive:disable-next-line:line-length-limit
+func (gs *gitService) ListRepositoryComments(ctx context.Context, serviceType string, repo string) ([]git.Comment, error) {
+	svc, err := gs.service(serviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	commentSvc, ok := svc.(commentBackend)
+	if !ok {
+		return nil, ErrCommentNotSupported
 	}
 
-	return nil, ErrInvalidServiceType
+	return commentSvc.ListRepositoryComments(ctx, repo)
 }
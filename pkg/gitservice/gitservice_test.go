@@ -0,0 +1,328 @@
+package gitservice_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circleous/gitseer/pkg/git"
+	"github.com/circleous/gitseer/pkg/gitservice"
+)
+
+// newEnterpriseTestServer emulates a GitHub Enterprise Server API under
+// /api/v3, every endpoint returns a single page
+func newEnterpriseTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v3/orgs/platform/members",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"login": "alice"}, {"login": "bob"},
+			})
+		})
+
+	mux.HandleFunc("/api/v3/orgs/platform/repos",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer ghe-token" {
+				t.Errorf("unexpected authorization %q",
+					r.Header.Get("Authorization"))
+			}
+
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"full_name": "platform/api", "fork": false,
+					"clone_url": "https://github.example.com/platform/api.git"},
+				{"full_name": "platform/fork", "fork": true,
+					"clone_url": "https://github.example.com/platform/fork.git"},
+			})
+		})
+
+	mux.HandleFunc("/api/v3/repos/platform/fork",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"full_name": "platform/fork", "fork": true,
+				"clone_url": "https://github.example.com/platform/fork.git",
+				"parent": map[string]interface{}{
+					"full_name": "upstream/api",
+					"clone_url": "https://github.example.com/upstream/api.git",
+				},
+			})
+		})
+
+	mux.HandleFunc("/api/v3/users/alice/gists",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": "aa5a315d61ae9438b18d",
+					"owner": map[string]string{"login": "alice"},
+					"git_pull_url": "https://github.example.com/gist/" +
+						"aa5a315d61ae9438b18d.git"},
+			})
+		})
+
+	repoAPI := "/api/v3/repos/platform/api/"
+	htmlURL := "https://github.example.com/platform/api/"
+
+	mux.HandleFunc(repoAPI+"issues",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("state") != "all" {
+				t.Errorf("expected state=all, got %s", r.URL.RawQuery)
+			}
+
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"number": 1, "title": "leak", "body": "token",
+					"html_url": htmlURL + "issues/1"},
+				{"number": 2, "title": "fix", "body": "",
+					"html_url":     htmlURL + "pull/2",
+					"pull_request": map[string]string{"url": ""}},
+			})
+		})
+
+	mux.HandleFunc(repoAPI+"issues/comments",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 11, "body": "password=hunter2",
+					"issue_url": "https://github.example.com" + repoAPI +
+						"issues/1",
+					"html_url": htmlURL + "issues/1#issuecomment-11"},
+			})
+		})
+
+	mux.HandleFunc(repoAPI+"pulls/comments",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 12, "body": "nit",
+					"pull_request_url": "https://github.example.com" +
+						repoAPI + "pulls/2",
+					"html_url": htmlURL + "pull/2#discussion_r12"},
+			})
+		})
+
+	mux.HandleFunc(repoAPI+"comments",
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 13, "body": "oops", "commit_id": "c0ffee",
+					"html_url": htmlURL + "commit/c0ffee#commitcomment-13"},
+			})
+		})
+
+	return httptest.NewServer(mux)
+}
+
+func TestNamedService(t *testing.T) {
+	srv := newEnterpriseTestServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	gs, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		Services: []gitservice.ServiceOptions{{
+			Name:    "ghe",
+			Type:    git.GITHUB,
+			BaseURL: srv.URL + "/api/v3/",
+			Token:   "ghe-token",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create git service, %v", err)
+	}
+
+	repos, err := gs.ListOrgRepositories(ctx, "ghe", "platform", nil)
+	if err != nil {
+		t.Fatalf("failed to list enterprise repositories, %v", err)
+	}
+
+	if len(repos) != 1 || repos[0].FullName() != "github.example.com/platform/api" {
+		t.Fatalf("unexpected enterprise repositories %v", repos)
+	}
+
+	if repos[0].Service != "ghe" || repos[0].Credential == nil {
+		t.Fatalf("expected ghe repository with credential, got %+v", repos[0])
+	}
+
+	// the service token is used for cloning
+	username, password, _ := repos[0].Credential.BasicAuth()
+	if username != "x-access-token" || password != "ghe-token" {
+		t.Errorf("unexpected clone credential %s:%s", username, password)
+	}
+
+	users, err := gs.ListOrgUsers(ctx, "ghe", "platform")
+	if err != nil {
+		t.Fatalf("failed to list enterprise org members, %v", err)
+	}
+
+	// users are listed from the same named service
+	for _, user := range users {
+		if user.Type != "ghe" {
+			t.Errorf("expected user type ghe, got %s", user.Type)
+		}
+	}
+	if len(users) != 2 {
+		t.Errorf("expected 2 org members, got %d", len(users))
+	}
+}
+
+func TestListForkUpstream(t *testing.T) {
+	srv := newEnterpriseTestServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	gs, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		Services: []gitservice.ServiceOptions{{
+			Name:    "ghe",
+			Type:    git.GITHUB,
+			BaseURL: srv.URL + "/api/v3/",
+			Token:   "ghe-token",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create git service, %v", err)
+	}
+
+	repos, err := gs.ListOrgRepositories(ctx, "ghe", "platform",
+		&git.ListRepositoriesOptions{WithFork: true})
+	if err != nil {
+		t.Fatalf("failed to list enterprise repositories, %v", err)
+	}
+
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repositories, got %v", repos)
+	}
+
+	if repos[0].Upstream != nil {
+		t.Errorf("expected no upstream of %s, got %+v", repos[0].Name,
+			repos[0].Upstream)
+	}
+
+	upstream := repos[1].Upstream
+	if upstream == nil {
+		t.Fatalf("expected upstream of %s", repos[1].Name)
+	}
+
+	if upstream.FullName() != "github.example.com/upstream/api" ||
+		upstream.Service != "ghe" || upstream.Credential == nil {
+		t.Errorf("unexpected upstream %+v", upstream)
+	}
+}
+
+func TestListUserGists(t *testing.T) {
+	srv := newEnterpriseTestServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	gs, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		Services: []gitservice.ServiceOptions{{
+			Name:    "ghe",
+			Type:    git.GITHUB,
+			BaseURL: srv.URL + "/api/v3/",
+			Token:   "ghe-token",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create git service, %v", err)
+	}
+
+	gists, err := gs.ListUserGists(ctx, "ghe", "alice")
+	if err != nil {
+		t.Fatalf("failed to list user gists, %v", err)
+	}
+
+	if len(gists) != 1 {
+		t.Fatalf("expected 1 gist, got %d", len(gists))
+	}
+
+	gist := gists[0]
+	if gist.Kind != git.KindGist ||
+		gist.FullName() != "github.example.com/alice/aa5a315d61ae9438b18d" {
+		t.Errorf("unexpected gist %+v", gist)
+	}
+
+	if gist.SSHURL != "git@github.example.com:gist/aa5a315d61ae9438b18d.git" {
+		t.Errorf("unexpected gist ssh url %s", gist.SSHURL)
+	}
+
+	if gist.Service != "ghe" || gist.Credential == nil {
+		t.Errorf("expected ghe gist with credential, got %+v", gist)
+	}
+
+	_, err = gs.ListUserGists(ctx, git.GITLAB, "alice")
+	if err != gitservice.ErrGistNotSupported {
+		t.Errorf("expected ErrGistNotSupported, got %v", err)
+	}
+}
+
+func TestListRepositoryComments(t *testing.T) {
+	srv := newEnterpriseTestServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	gs, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		Services: []gitservice.ServiceOptions{{
+			Name:    "ghe",
+			Type:    git.GITHUB,
+			BaseURL: srv.URL + "/api/v3/",
+			Token:   "ghe-token",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create git service, %v", err)
+	}
+
+	comments, err := gs.ListRepositoryComments(ctx, "ghe", "platform/api")
+	if err != nil {
+		t.Fatalf("failed to list repository comments, %v", err)
+	}
+
+	var paths []string
+	for _, comment := range comments {
+		paths = append(paths, comment.Path)
+	}
+
+	expected := "[issues/1 pull/2 issues/1#issuecomment-11 " +
+		"pull/2#discussion_r12 commit/c0ffee#commitcomment-13]"
+	if got := fmt.Sprint(paths); got != expected {
+		t.Errorf("unexpected comment paths %s", got)
+	}
+
+	if comments[2].Body != "password=hunter2" ||
+		comments[2].URL != "https://github.example.com/platform/api/"+
+			"issues/1#issuecomment-11" {
+		t.Errorf("unexpected issue comment %+v", comments[2])
+	}
+
+	if comments[4].CommitHash != "c0ffee" {
+		t.Errorf("expected commit comment of c0ffee, got %+v", comments[4])
+	}
+
+	_, err = gs.ListRepositoryComments(ctx, git.GITLAB, "platform/api")
+	if err != gitservice.ErrCommentNotSupported {
+		t.Errorf("expected ErrCommentNotSupported, got %v", err)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := gitservice.NewGitService(ctx, &gitservice.Options{
+		Services: []gitservice.ServiceOptions{{Name: "svn", Type: "svn"}},
+	})
+	if !errors.Is(err, gitservice.ErrInvalidServiceType) {
+		t.Errorf("expected ErrInvalidServiceType, got %v", err)
+	}
+
+	gs, err := gitservice.NewGitService(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to create git service, %v", err)
+	}
+
+	_, err = gs.ListOrgUsers(ctx, "unknown", "platform")
+	if err != gitservice.ErrInvalidServiceType {
+		t.Errorf("expected ErrInvalidServiceType, got %v", err)
+	}
+
+	_, err = gs.ListOrgUsers(ctx, git.GITEA, "platform")
+	if err != gitservice.ErrServiceNotConfigured {
+		t.Errorf("expected ErrServiceNotConfigured, got %v", err)
+	}
+}
@@ -22,7 +22,9 @@ type Base struct {
 	// assign a SHA-1 hash of the match string
 	ID string `toml:"id"`
 
-	// Entropy
+	// Entropy is the minimum Shannon entropy of a content match, matches
+	// below it are dropped. The named capture group "secret" is measured if
+	// it's defined in the regex, else the whole match
 	Entropy float64 `toml:"entropy"`
 
 	// Description of the signature, added to findings
@@ -51,5 +53,8 @@ type Match struct {
 	Substring   string
 	SignatureID string
 	Description string
-	LineNumber  int32
+	// LineNumber is the zero based line number of the match in the content
+	LineNumber int32
+	// Entropy is the Shannon entropy of the content match
+	Entropy float64
 }
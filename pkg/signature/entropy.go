@@ -0,0 +1,31 @@
+package signature
+
+import "math"
+
+// secretGroupName is the named capture group used for the entropy check, when
+// it doesn't exist, the whole match is used instead
+const secretGroupName = "secret"
+
+// ShannonEntropy calculates the Shannon entropy in bits per byte of s
+func ShannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	var freq [256]int
+	for i := 0; i < len(s); i++ {
+		freq[s[i]]++
+	}
+
+	var entropy float64
+	length := float64(len(s))
+	for _, count := range freq {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -50,8 +51,32 @@ func LoadSignature(file string) (*Signature, error) {
 	return &signature, err
 }
 
+// ContentFingerprint return a SHA-1 hash of the enabled content signatures,
+// the content matches of the same content are only the same with the same
+// fingerprint
+func ContentFingerprint(signatures []Base) string {
+	hash := sha1.New()
+	for _, signature := range signatures {
+		if !signature.Enable || signature.Type != contentType {
+			continue
+		}
+
+		fmt.Fprintf(hash, "%q %q %q %v\n", signature.ID,
+			signature.Description, signature.MatchString, signature.Entropy)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 // ExtractMatch extract any match with signatures given filename and filecontent
 func ExtractMatch(filename, content string, signatures []Base) []Match {
+	matches := ExtractPathMatch(filename, signatures)
+	return append(matches, ExtractContentMatch(content, signatures)...)
+}
+
+// ExtractPathMatch extract any match with extension, filename and path
+// signatures given filename
+func ExtractPathMatch(filename string, signatures []Base) []Match {
 	var matches []Match
 
 	for _, signature := range signatures {
@@ -89,20 +114,44 @@ func ExtractMatch(filename, content string, signatures []Base) []Match {
 					Substring:   filename,
 				})
 			}
-		case contentType:
-			re := signature.Match.(*regexp.Regexp)
-			founds := re.FindAllStringIndex(content, -1)
-			if founds != nil {
-				for _, found := range founds {
-					matches = append(matches, Match{
-						SignatureID: signature.ID,
-						Description: signature.Description,
-						Substring:   content[found[0]:found[1]],
-						LineNumber:  StringPosToLineNumber(content, found[0]),
-					})
-				}
+		}
+	}
+
+	return matches
+}
+
+// ExtractContentMatch extract any match with content signatures given
+// content, line numbers are relative to the start of content
+func ExtractContentMatch(content string, signatures []Base) []Match {
+	var matches []Match
+
+	for _, signature := range signatures {
+		if !signature.Enable || signature.Type != contentType {
+			continue
+		}
+
+		re := signature.Match.(*regexp.Regexp)
+		secretIdx := re.SubexpIndex(secretGroupName)
+		founds := re.FindAllStringSubmatchIndex(content, -1)
+		for _, found := range founds {
+			secret := content[found[0]:found[1]]
+			if secretIdx > 0 && found[2*secretIdx] >= 0 {
+				secret = content[found[2*secretIdx]:found[2*secretIdx+1]]
+			}
+
+			// drop low entropy matches, mostly placeholder values
+			entropy := ShannonEntropy(secret)
+			if entropy < signature.Entropy {
+				continue
 			}
 
+			matches = append(matches, Match{
+				SignatureID: signature.ID,
+				Description: signature.Description,
+				Substring:   content[found[0]:found[1]],
+				LineNumber:  StringPosToLineNumber(content, found[0]),
+				Entropy:     entropy,
+			})
 		}
 	}
 
@@ -0,0 +1,72 @@
+package signature_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/circleous/gitseer/pkg/signature"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		entropy float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"ab", 1},
+		{"abcd", 2},
+	} {
+		if e := signature.ShannonEntropy(tc.s); math.Abs(e-tc.entropy) > 1e-9 {
+			t.Errorf("entropy of %q expected %f, got %f", tc.s, tc.entropy, e)
+		}
+	}
+}
+
+func TestExtractMatchEntropy(t *testing.T) {
+	// the password signature of the example signatures
+	sig, err := signature.LoadSignature("../../examples/signatures.toml")
+	if err != nil {
+		t.Fatalf("failed to load signatures, %v", err)
+	}
+
+	var sigs []signature.Base
+	for _, s := range sig.Signatures {
+		if s.ID == "205cb248412f369e90e382f739c691be2ee77a81" {
+			sigs = append(sigs, s)
+		}
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("password signature not found")
+	}
+
+	content := "user = \"admin\"\n" +
+		"password = \"changeme\"\n" +
+		"password = \"Xk9$fQ2!pL7zR4\"\n" +
+		"password: q7Lm2Zx9\n"
+
+	matches := signature.ExtractMatch("config.ini", content, sigs)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", matches)
+	}
+
+	// only the value is measured, not the quotes and the separator
+	for i, tc := range []struct {
+		line   int32
+		secret string
+	}{
+		{2, "Xk9$fQ2!pL7zR4"},
+		{3, "q7Lm2Zx9"},
+	} {
+		if matches[i].LineNumber != tc.line {
+			t.Errorf("expected match in line %d, got %d", tc.line,
+				matches[i].LineNumber)
+		}
+
+		entropy := signature.ShannonEntropy(tc.secret)
+		if math.Abs(matches[i].Entropy-entropy) > 1e-9 {
+			t.Errorf("expected entropy of %q %f, got %f", tc.secret,
+				entropy, matches[i].Entropy)
+		}
+	}
+}